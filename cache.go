@@ -16,6 +16,11 @@ import (
 type Cache struct {
 	logger *zap.Logger
 
+	lineEndings     LineEndingPolicy
+	bom             BOMPolicy
+	encodings       []EncodingRule
+	defaultEncoding Encoding
+
 	rootUri  span.URI
 	rootPath string
 
@@ -33,6 +38,30 @@ func (c *Cache) getFile(uri span.URI) *file {
 	return c.files[uri]
 }
 
+// fileVersion returns the version of the file, or -1 if it isn't cached. Unlike `GetFile`, it doesn't copy the
+// content.
+func (c *Cache) fileVersion(uri span.URI) int32 {
+	f := c.getFile(uri)
+	if f == nil {
+		return -1
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.version
+}
+
+// openedVersion returns the version of the file, and `true` if it is open in the IDE. Unlike `GetFile`, it doesn't
+// copy the content.
+func (c *Cache) openedVersion(uri span.URI) (int32, bool) {
+	f := c.getFile(uri)
+	if f == nil {
+		return 0, false
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.version, f.ideContent != nil
+}
+
 func (c *Cache) setFile(f *file) *file {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -60,24 +89,18 @@ func (c *Cache) initialize(params *protocol.ParamInitialize, res *protocol.Initi
 	c.files = fs
 	c.mu.Unlock()
 
-	if res == nil {
-		res = &protocol.InitializeResult{}
-	}
+	return res, nil
+}
 
-	var tds *protocol.TextDocumentSyncOptions
-	ok := false
-	if res.Capabilities.TextDocumentSync != nil {
-		tds, ok = res.Capabilities.TextDocumentSync.(*protocol.TextDocumentSyncOptions)
-	}
-	if !ok {
-		tds = &protocol.TextDocumentSyncOptions{}
-		res.Capabilities.TextDocumentSync = tds
+// capabilities returns the text document synchronization capabilities the cache relies on.
+func (c *Cache) capabilities() *protocol.ServerCapabilities {
+	return &protocol.ServerCapabilities{
+		TextDocumentSync: &protocol.TextDocumentSyncOptions{
+			OpenClose: true,
+			Change:    protocol.Incremental,
+			Save:      &protocol.SaveOptions{IncludeText: false},
+		},
 	}
-	tds.OpenClose = true
-	tds.Change = protocol.Incremental
-	tds.Save = &protocol.SaveOptions{IncludeText: false}
-
-	return res, nil
 }
 
 func (c *Cache) didChange(params *protocol.DidChangeTextDocumentParams) (err error) {
@@ -0,0 +1,109 @@
+package lsp_srv_ex
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// EncodingRule assigns an encoding to the saved content of the files matching a glob pattern.
+type EncodingRule struct {
+	// Pattern uses `path.Match` syntax. If it contains a '/' it is matched against the slash-separated path relative
+	// to the root directory, otherwise it is matched against the file name only.
+	Pattern string `json:"pattern"`
+	// Encoding is an IANA name of the encoding, like `Latin1` or `ShiftJIS`.
+	Encoding Encoding `json:"encoding"`
+}
+
+func (er EncodingRule) matches(relPath string) bool {
+	name := relPath
+	if !strings.Contains(er.Pattern, "/") {
+		name = path.Base(relPath)
+	}
+	ok, err := path.Match(er.Pattern, name)
+	return ok && err == nil
+}
+
+var (
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// savedEncoding determines the encoding of the saved content of the file at `p`.
+// The configured rules are checked first, in order. If none of them matches, the encoding is detected by BOM, and by
+// UTF-8 validity, with fallback to the configured default encoding.
+func (c *Cache) savedEncoding(p string, content []byte) Encoding {
+	if len(c.encodings) > 0 {
+		rel := p
+		if c.rootPath != "" {
+			if r, err := filepath.Rel(c.rootPath, p); err == nil {
+				rel = r
+			}
+		}
+		rel = filepath.ToSlash(rel)
+		for _, er := range c.encodings {
+			if er.matches(rel) {
+				return er.Encoding
+			}
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(content, utf8BOM):
+		return UTF8
+	case bytes.HasPrefix(content, utf16LEBOM):
+		return UTF16LE
+	case bytes.HasPrefix(content, utf16BEBOM):
+		return UTF16BE
+	case utf8.Valid(content):
+		return UTF8
+	default:
+		return c.defaultEncoding
+	}
+}
+
+func lookupEncoding(name Encoding) (encoding.Encoding, error) {
+	e, err := ianaindex.IANA.Encoding(string(name))
+	if err != nil {
+		return nil, fmt.Errorf("encoding '%s': %w", name, err)
+	}
+	if e == nil {
+		return nil, fmt.Errorf("encoding '%s' is not supported", name)
+	}
+	return e, nil
+}
+
+// normalizeSavedContent transcodes the saved content of the file at `p` to UTF-8, and applies the configured policies
+// to it. The returned format describes the content as it was before transcoding and normalization.
+func (c *Cache) normalizeSavedContent(p string, content []byte) ([]byte, TextFormat, error) {
+	enc := c.savedEncoding(p, content)
+	switch strings.ToLower(string(enc)) {
+	case string(UTF8), "utf8":
+		content, tf := c.normalizeContent(content)
+		return content, tf, nil
+	case string(UnknownEncoding):
+		// Neither valid UTF-8, nor a known encoding: keep the bytes.
+		content, tf := c.normalizeContent(content)
+		tf.Encoding = UnknownEncoding
+		return content, tf, nil
+	}
+
+	e, err := lookupEncoding(enc)
+	if err != nil {
+		return nil, TextFormat{}, err
+	}
+	decoded, err := e.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, TextFormat{}, fmt.Errorf("decoding '%s' as '%s': %w", p, enc, err)
+	}
+	// A BOM, if any, is transcoded as well, so it's handled the same way as for UTF-8 content.
+	decoded, tf := c.normalizeContent(decoded)
+	tf.Encoding = enc
+	return decoded, tf, nil
+}
@@ -0,0 +1,140 @@
+package lsp_srv_ex
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncodingRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		{"*.txt", "a.txt", true},
+		{"*.txt", "docs/a.txt", true},
+		{"*.txt", "a.md", false},
+		{"docs/*.txt", "docs/a.txt", true},
+		{"docs/*.txt", "other/a.txt", false},
+		{"docs/*.txt", "docs/sub/a.txt", false},
+		{"legacy/*/*.c", "legacy/x/main.c", true},
+		{"[", "a.txt", false},
+	}
+	for _, tt := range tests {
+		if got := (EncodingRule{Pattern: tt.pattern}).matches(tt.relPath); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.pattern, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeSavedContent(t *testing.T) {
+	root := filepath.FromSlash("/root")
+	tests := []struct {
+		name       string
+		path       string
+		encodings  []EncodingRule
+		defaultEnc Encoding
+		bom        BOMPolicy
+		content    []byte
+		want       string
+		wantEnc    Encoding
+		wantBOM    bool
+	}{
+		{
+			name:    "UTF-8",
+			path:    "a.txt",
+			content: []byte("héllo"),
+			want:    "héllo",
+			wantEnc: UTF8,
+		},
+		{
+			name:    "UTF-8 with BOM",
+			path:    "a.txt",
+			content: []byte("\uFEFFa"),
+			want:    "\uFEFFa",
+			wantEnc: UTF8,
+			wantBOM: true,
+		},
+		{
+			name:    "UTF-8 with BOM stripped",
+			path:    "a.txt",
+			bom:     StripBOM,
+			content: []byte("\uFEFFa"),
+			want:    "a",
+			wantEnc: UTF8,
+			wantBOM: true,
+		},
+		{
+			name:    "UTF-16LE detected by BOM",
+			path:    "a.txt",
+			content: []byte{0xFF, 0xFE, 'a', 0, 0xE9, 0},
+			want:    "\uFEFFaé",
+			wantEnc: UTF16LE,
+			wantBOM: true,
+		},
+		{
+			name:    "UTF-16BE detected by BOM, stripped",
+			path:    "a.txt",
+			bom:     StripBOM,
+			content: []byte{0xFE, 0xFF, 0, 'a', 0, 0xE9},
+			want:    "aé",
+			wantEnc: UTF16BE,
+			wantBOM: true,
+		},
+		{
+			name:      "UTF-16LE by rule",
+			path:      "a.txt",
+			encodings: []EncodingRule{{Pattern: "*.txt", Encoding: UTF16LE}},
+			content:   []byte{'a', 0, 0xE9, 0},
+			want:      "aé",
+			wantEnc:   UTF16LE,
+		},
+		{
+			name:      "Latin-1 by rule",
+			path:      "docs/a.txt",
+			encodings: []EncodingRule{{Pattern: "docs/*", Encoding: Latin1}},
+			content:   []byte{'a', 0xE9},
+			want:      "aé",
+			wantEnc:   Latin1,
+		},
+		{
+			name:      "first rule wins",
+			path:      "a.sjis",
+			encodings: []EncodingRule{{Pattern: "*.sjis", Encoding: ShiftJIS}, {Pattern: "*", Encoding: Latin1}},
+			content:   []byte{0x93, 0xFA, 0x96, 0x7B},
+			want:      "日本",
+			wantEnc:   ShiftJIS,
+		},
+		{
+			name:       "Shift-JIS by default",
+			path:       "a.txt",
+			defaultEnc: ShiftJIS,
+			content:    []byte{0x93, 0xFA, 0x96, 0x7B},
+			want:       "日本",
+			wantEnc:    ShiftJIS,
+		},
+		{
+			name:    "unknown",
+			path:    "a.txt",
+			content: []byte{'a', 0xE9},
+			want:    "a\xE9",
+			wantEnc: UnknownEncoding,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{rootPath: root, encodings: tt.encodings, defaultEncoding: tt.defaultEnc, bom: tt.bom}
+			got, tf, err := c.normalizeSavedContent(filepath.Join(root, filepath.FromSlash(tt.path)), tt.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, []byte(tt.want)) {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+			if tf.Encoding != tt.wantEnc || tf.BOM != tt.wantBOM {
+				t.Errorf("format = %+v, want encoding %q and BOM %v", tf, tt.wantEnc, tt.wantBOM)
+			}
+		})
+	}
+}
@@ -27,6 +27,9 @@ type File struct {
 	file    *file
 	Content []byte
 	Version int32
+	// Format is the format of the content as received from the IDE, detected before any normalization is applied.
+	Format TextFormat
+	mapper *Mapper
 }
 
 // URI returns `span.URI` of the file.
@@ -44,6 +47,12 @@ func (f *File) IsOpened() bool {
 	return f.file.IsOpened()
 }
 
+// Mapper returns the `Mapper` built for the content version of this `File`, or `nil` if the file isn't open in the IDE.
+// The same `Mapper` instance is shared by all `File` instances of the same version.
+func (f *File) Mapper() *Mapper {
+	return f.mapper
+}
+
 // ChangedMeanwhile checks if the original file is changed since
 // this detached `File` instance is created.
 func (f *File) ChangedMeanwhile() bool {
@@ -60,6 +69,13 @@ func (f *File) GetSavedContent(forceRead bool) ([]byte, error) {
 	return f.file.getSavedContent(forceRead)
 }
 
+// GetSavedFormat returns the format of the saved content of the file, detected before any normalization is applied.
+// `forceRead`: if set to `true` forces reading the content
+// from the disk, even if it's cached.
+func (f *File) GetSavedFormat(forceRead bool) (TextFormat, error) {
+	return f.file.getSavedFormat(forceRead)
+}
+
 // file represents a file in cache.
 type file struct {
 	parent *Cache
@@ -70,7 +86,11 @@ type file struct {
 
 	mu           sync.RWMutex // Content lock, protects the following fields
 	savedContent []byte
+	savedFormat  TextFormat
 	ideContent   []byte
+	rawContent   []byte // the content as the IDE has it, if it differs from ideContent because of the normalization
+	ideFormat    TextFormat
+	mapper       *Mapper // built for ideContent
 	version      int32
 }
 
@@ -103,6 +123,8 @@ func (f *file) detach() *File {
 	df := &File{
 		file:    f,
 		Version: f.version,
+		Format:  f.ideFormat,
+		mapper:  f.mapper,
 	}
 
 	if f.ideContent != nil {
@@ -134,10 +156,24 @@ func (f *file) getSavedContent(forceRead bool) ([]byte, error) {
 	return cp, nil
 }
 
+func (f *file) getSavedFormat(forceRead bool) (TextFormat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if forceRead {
+		f.savedContent = nil
+	}
+	if _, err := f.getSavedContentLocked(); err != nil {
+		return TextFormat{}, err
+	}
+	return f.savedFormat, nil
+}
+
 func (f *file) getSavedContentLocked() ([]byte, error) {
 	if f.savedContent == nil {
 		if c, err := os.ReadFile(f.Path()); err == nil {
-			f.savedContent = c
+			if f.savedContent, f.savedFormat, err = f.parent.normalizeSavedContent(f.Path(), c); err != nil {
+				return nil, err
+			}
 		} else {
 			return nil, err
 		}
@@ -149,13 +185,23 @@ func (f *file) mergeChanges(params *protocol.DidChangeTextDocumentParams) error
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
+	// The changes are applied to the content as the IDE has it, and normalized afterwards, since a line ending may be
+	// split between the changes (e.g. CR at the end of one, and LF at the start of the next one).
 	content := f.ideContent
+	var m *protocol.Mapper
+	if f.rawContent != nil {
+		content = f.rawContent
+	} else if f.mapper != nil {
+		m = f.mapper.Mapper
+	}
 	for _, cc := range params.ContentChanges {
 		// TODO(adonovan): refactor to use diff.Apply, which is robust w.r.t.
 		// out-of-order or overlapping changes---and much more efficient.
 
 		// Make sure to update column mapper along with the content.
-		m := protocol.NewMapper(f.uri, content)
+		if m == nil {
+			m = protocol.NewMapper(f.uri, content)
+		}
 		if cc.Range == nil {
 			return fmt.Errorf("%w: didChange unexpected nil range for change", jsonrpc2.ErrInternal)
 		}
@@ -172,24 +218,41 @@ func (f *file) mergeChanges(params *protocol.DidChangeTextDocumentParams) error
 		buf.WriteString(cc.Text)
 		buf.Write(content[end:])
 		content = buf.Bytes()
+		m = nil
 	}
 
-	f.ideContent = content
+	f.ideFormat.LineEnding = detectLineEnding(content)
+	f.setNormalizedLocked(content)
 	f.version = params.TextDocument.Version
+	f.mapper = newMapper(f.uri, f.ideContent, f.version)
 
 	return nil
 }
 
+// setNormalizedLocked sets the content as the IDE has it, and its normalized version.
+func (f *file) setNormalizedLocked(content []byte) {
+	f.ideContent = f.parent.normalizeText(content)
+	f.rawContent = nil
+	if f.parent.lineEndings == NormalizeLineEndings && bytes.IndexByte(content, '\r') >= 0 {
+		f.rawContent = content
+	}
+}
+
 func (f *file) setIdeContent(content []byte, version int32) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	f.ideContent = content
+	// The BOM is kept regardless of the policy, since the positions sent by the IDE count it.
+	f.ideFormat = detectFormat(content)
+	f.setNormalizedLocked(content)
 	f.version = version
+	f.mapper = newMapper(f.uri, f.ideContent, version)
 }
 
 func (f *file) closed() {
 	f.mu.Lock()
 	f.ideContent = nil
+	f.rawContent = nil
+	f.mapper = nil
 	f.mu.Unlock()
 }
@@ -0,0 +1,61 @@
+package lsp_srv_ex
+
+import (
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+func TestMergeChangesBOM(t *testing.T) {
+	tests := []struct {
+		name        string
+		lineEndings LineEndingPolicy
+		bom         BOMPolicy
+		want        string
+	}{
+		{
+			name: "preserved",
+			want: "\uFEFFab X\r\ncd\r\n",
+		},
+		{
+			name:        "normalized",
+			lineEndings: NormalizeLineEndings,
+			bom:         StripBOM,
+			want:        "\uFEFFab X\ncd\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHelper(&Config{Caching: true, LineEndings: tt.lineEndings, BOM: tt.bom}, zap.NewNop())
+			f := h.Cache.setFile(&file{parent: h.Cache, uri: testURI.SpanURI()})
+			f.setIdeContent([]byte("\uFEFFab cd\r\ncd\r\n"), 1)
+
+			// The BOM counts as a character, so "cd" on line 0 is at characters 4-6.
+			err := f.mergeChanges(&protocol.DidChangeTextDocumentParams{
+				TextDocument: protocol.VersionedTextDocumentIdentifier{Version: 2},
+				ContentChanges: []protocol.TextDocumentContentChangeEvent{{
+					Range: &protocol.Range{
+						Start: protocol.Position{Line: 0, Character: 4},
+						End:   protocol.Position{Line: 0, Character: 6},
+					},
+					Text: "X",
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			df := f.detach()
+			if got := string(df.Content); got != tt.want {
+				t.Fatalf("content = %q, want %q", got, tt.want)
+			}
+			if !df.Format.BOM || df.Format.LineEnding != CRLF {
+				t.Fatalf("format = %+v, want BOM and CRLF", df.Format)
+			}
+			if df.Version != 2 {
+				t.Fatalf("version = %d, want 2", df.Version)
+			}
+		})
+	}
+}
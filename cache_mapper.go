@@ -0,0 +1,136 @@
+package lsp_srv_ex
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/lsp-srv/span"
+)
+
+// Mapper converts between byte offsets, LSP positions and lines of a single version of the file content.
+// The offset/position conversions are provided by the embedded `protocol.Mapper`. The instance is built once per file
+// version, and it is safe for concurrent use.
+type Mapper struct {
+	*protocol.Mapper
+	version int32
+
+	linesOnce  sync.Once
+	lineStarts []int // offsets of the first bytes of the lines
+}
+
+func newMapper(uri span.URI, content []byte, version int32) *Mapper {
+	return &Mapper{
+		Mapper:  protocol.NewMapper(uri, content),
+		version: version,
+	}
+}
+
+// Version returns the version of the file content the mapper is built for.
+func (m *Mapper) Version() int32 {
+	return m.version
+}
+
+func (m *Mapper) lines() []int {
+	m.linesOnce.Do(func() {
+		m.lineStarts = []int{0}
+		for i, b := range m.Content {
+			if b == '\n' {
+				m.lineStarts = append(m.lineStarts, i+1)
+			}
+		}
+	})
+	return m.lineStarts
+}
+
+// LineCount returns the number of lines in the content.
+func (m *Mapper) LineCount() int {
+	return len(m.lines())
+}
+
+// LineOffset returns the offset of the first byte of the (0-based) `line`.
+func (m *Mapper) LineOffset(line int) (int, error) {
+	ls := m.lines()
+	if line < 0 || line >= len(ls) {
+		return 0, fmt.Errorf("line %d out of range [0, %d)", line, len(ls))
+	}
+	return ls[line], nil
+}
+
+// OffsetLine returns the (0-based) line containing `offset`.
+func (m *Mapper) OffsetLine(offset int) (int, error) {
+	if offset < 0 || offset > len(m.Content) {
+		return 0, fmt.Errorf("offset %d out of range [0, %d]", offset, len(m.Content))
+	}
+	ls := m.lines()
+	return sort.Search(len(ls), func(i int) bool { return ls[i] > offset }) - 1, nil
+}
+
+// Line returns the content of the (0-based) `line`, without the line ending.
+func (m *Mapper) Line(line int) ([]byte, error) {
+	start, err := m.LineOffset(line)
+	if err != nil {
+		return nil, err
+	}
+	end := len(m.Content)
+	if ls := m.lines(); line+1 < len(ls) {
+		end = ls[line+1] - 1
+	}
+	return bytes.TrimSuffix(m.Content[start:end], []byte{'\r'}), nil
+}
+
+// PositionLine returns the content of the line containing `pos`, without the line ending.
+func (m *Mapper) PositionLine(pos protocol.Position) ([]byte, error) {
+	return m.Line(int(pos.Line))
+}
+
+// IsWordRune is the default word character predicate used by `WordAt`: letters, digits and underscore.
+func IsWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// WordAt returns the word containing `pos`, or ending at it, and its range. The returned word is empty if there's no
+// word at `pos`. `isWordRune` determines the word characters; if `nil`, `IsWordRune` is used.
+func (m *Mapper) WordAt(pos protocol.Position, isWordRune func(rune) bool) (string, protocol.Range, error) {
+	if isWordRune == nil {
+		isWordRune = IsWordRune
+	}
+	offset, err := m.PositionOffset(pos)
+	if err != nil {
+		return "", protocol.Range{}, err
+	}
+	line, err := m.OffsetLine(offset)
+	if err != nil {
+		return "", protocol.Range{}, err
+	}
+	lineStart, _ := m.LineOffset(line)
+	text, _ := m.Line(line)
+	lineEnd := lineStart + len(text)
+
+	start := offset
+	for start > lineStart {
+		r, size := utf8.DecodeLastRune(m.Content[lineStart:start])
+		if !isWordRune(r) {
+			break
+		}
+		start -= size
+	}
+	end := offset
+	for end < lineEnd {
+		r, size := utf8.DecodeRune(m.Content[end:lineEnd])
+		if !isWordRune(r) {
+			break
+		}
+		end += size
+	}
+
+	rng, err := m.OffsetRange(start, end)
+	if err != nil {
+		return "", protocol.Range{}, err
+	}
+	return string(m.Content[start:end]), rng, nil
+}
@@ -0,0 +1,142 @@
+package lsp_srv_ex
+
+import (
+	"testing"
+	"unicode"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+)
+
+// mapperContent has a CRLF line, multi-byte runes (including one encoded as a UTF-16 surrogate pair), and a last line
+// without the line ending. The lines start at the offsets 0, 15 and 28.
+const mapperContent = "héllo wörld\r\n日本_語 x\n𝒳y"
+
+func newTestMapper(content string) *Mapper {
+	return newMapper(testURI.SpanURI(), []byte(content), 1)
+}
+
+func TestMapperLines(t *testing.T) {
+	m := newTestMapper(mapperContent)
+	if n := m.LineCount(); n != 3 {
+		t.Fatalf("LineCount() = %d, want 3", n)
+	}
+
+	offsets := []struct {
+		line    int
+		want    int
+		wantErr bool
+	}{
+		{line: 0, want: 0},
+		{line: 1, want: 15},
+		{line: 2, want: 28},
+		{line: 3, wantErr: true},
+		{line: -1, wantErr: true},
+	}
+	for _, tt := range offsets {
+		got, err := m.LineOffset(tt.line)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("LineOffset(%d) = %d, %v, want %d, error %v", tt.line, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	lines := []struct {
+		offset  int
+		want    int
+		wantErr bool
+	}{
+		{offset: 0, want: 0},
+		{offset: 13, want: 0}, // CR
+		{offset: 14, want: 0}, // LF
+		{offset: 15, want: 1},
+		{offset: 27, want: 1},
+		{offset: 28, want: 2},
+		{offset: 33, want: 2}, // the end of the content
+		{offset: 34, wantErr: true},
+		{offset: -1, wantErr: true},
+	}
+	for _, tt := range lines {
+		got, err := m.OffsetLine(tt.offset)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("OffsetLine(%d) = %d, %v, want %d, error %v", tt.offset, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	texts := []struct {
+		content string
+		line    int
+		want    string
+		wantErr bool
+	}{
+		{content: mapperContent, line: 0, want: "héllo wörld"},
+		{content: mapperContent, line: 1, want: "日本_語 x"},
+		{content: mapperContent, line: 2, want: "𝒳y"},
+		{content: mapperContent, line: 3, wantErr: true},
+		{content: "a\n", line: 1, want: ""},
+		{content: "", line: 0, want: ""},
+	}
+	for _, tt := range texts {
+		got, err := newTestMapper(tt.content).Line(tt.line)
+		if (err != nil) != tt.wantErr || string(got) != tt.want {
+			t.Errorf("Line(%d) of %q = %q, %v, want %q, error %v", tt.line, tt.content, got, err, tt.want,
+				tt.wantErr)
+		}
+	}
+}
+
+func TestMapperWordAt(t *testing.T) {
+	m := newTestMapper(mapperContent)
+	rng := func(line, start, end uint32) protocol.Range {
+		return protocol.Range{
+			Start: protocol.Position{Line: line, Character: start},
+			End:   protocol.Position{Line: line, Character: end},
+		}
+	}
+	tests := []struct {
+		name       string
+		pos        protocol.Position
+		isWordRune func(rune) bool
+		want       string
+		wantRange  protocol.Range
+		wantErr    bool
+	}{
+		{name: "start", pos: protocol.Position{Line: 0, Character: 0}, want: "héllo", wantRange: rng(0, 0, 5)},
+		{name: "inside", pos: protocol.Position{Line: 0, Character: 3}, want: "héllo", wantRange: rng(0, 0, 5)},
+		{name: "ending at", pos: protocol.Position{Line: 0, Character: 5}, want: "héllo", wantRange: rng(0, 0, 5)},
+		{name: "before CR", pos: protocol.Position{Line: 0, Character: 11}, want: "wörld", wantRange: rng(0, 6, 11)},
+		{name: "multi-byte", pos: protocol.Position{Line: 1, Character: 1}, want: "日本_語", wantRange: rng(1, 0, 4)},
+		{
+			name:       "custom word runes",
+			pos:        protocol.Position{Line: 1, Character: 1},
+			isWordRune: unicode.IsLetter,
+			want:       "日本",
+			wantRange:  rng(1, 0, 2),
+		},
+		{name: "single rune", pos: protocol.Position{Line: 1, Character: 5}, want: "x", wantRange: rng(1, 5, 6)},
+		{name: "surrogate pair", pos: protocol.Position{Line: 2, Character: 3}, want: "𝒳y", wantRange: rng(2, 0, 3)},
+		{
+			name:       "no word",
+			pos:        protocol.Position{Line: 1, Character: 3},
+			isWordRune: unicode.IsDigit,
+			want:       "",
+			wantRange:  rng(1, 3, 3),
+		},
+		{name: "out of range", pos: protocol.Position{Line: 5}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotRange, err := m.WordAt(tt.pos, tt.isWordRune)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || gotRange != tt.wantRange {
+				t.Fatalf("WordAt(%v) = %q, %v, want %q, %v", tt.pos, got, gotRange, tt.want, tt.wantRange)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package lsp_srv_ex
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// LineEndingPolicy determines how the Cache treats line endings of the content it stores.
+type LineEndingPolicy int
+
+const (
+	// PreserveLineEndings keeps the content exactly as received.
+	PreserveLineEndings LineEndingPolicy = iota
+	// NormalizeLineEndings converts CRLF and CR line endings to LF.
+	NormalizeLineEndings
+)
+
+func (p LineEndingPolicy) String() string {
+	switch p {
+	case PreserveLineEndings:
+		return "PreserveLineEndings"
+	case NormalizeLineEndings:
+		return "NormalizeLineEndings"
+	default:
+		return fmt.Sprintf("Unknown line ending policy %d", p)
+	}
+}
+
+// BOMPolicy determines how the Cache treats the UTF-8 byte order mark (BOM).
+type BOMPolicy int
+
+const (
+	// PreserveBOM keeps the BOM, if present.
+	PreserveBOM BOMPolicy = iota
+	// StripBOM removes the BOM, if present.
+	StripBOM
+)
+
+func (p BOMPolicy) String() string {
+	switch p {
+	case PreserveBOM:
+		return "PreserveBOM"
+	case StripBOM:
+		return "StripBOM"
+	default:
+		return fmt.Sprintf("Unknown BOM policy %d", p)
+	}
+}
+
+// LineEnding represents the line ending style detected in a content.
+type LineEnding int
+
+const (
+	// NoLineEnding means that the content has no line breaks.
+	NoLineEnding LineEnding = iota
+	LF
+	CRLF
+	CR
+	// MixedLineEndings means that the content uses more than one line ending style.
+	MixedLineEndings
+)
+
+func (le LineEnding) String() string {
+	switch le {
+	case NoLineEnding:
+		return "None"
+	case LF:
+		return "LF"
+	case CRLF:
+		return "CRLF"
+	case CR:
+		return "CR"
+	case MixedLineEndings:
+		return "Mixed"
+	default:
+		return fmt.Sprintf("Unknown line ending %d", le)
+	}
+}
+
+// combine returns the line ending style of a content that contains both `le` and `other` styles.
+func (le LineEnding) combine(other LineEnding) LineEnding {
+	switch {
+	case le == other || other == NoLineEnding:
+		return le
+	case le == NoLineEnding:
+		return other
+	default:
+		return MixedLineEndings
+	}
+}
+
+// Encoding represents the character encoding of a content, by its IANA name.
+type Encoding string
+
+const (
+	// UnknownEncoding is reported for the content that isn't valid UTF-8, when no other encoding is configured for it.
+	UnknownEncoding Encoding = ""
+	UTF8            Encoding = "utf-8"
+	UTF16LE         Encoding = "UTF-16LE"
+	UTF16BE         Encoding = "UTF-16BE"
+	Latin1          Encoding = "ISO-8859-1"
+	Windows1252     Encoding = "windows-1252"
+	ShiftJIS        Encoding = "Shift_JIS"
+	EUCJP           Encoding = "EUC-JP"
+)
+
+// TextFormat describes the format detected in a content, before any normalization is applied.
+type TextFormat struct {
+	LineEnding LineEnding
+	Encoding   Encoding
+	// BOM is `true` if the content starts with the byte order mark.
+	BOM bool
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+func detectLineEnding(content []byte) LineEnding {
+	le := NoLineEnding
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '\n':
+			le = le.combine(LF)
+		case '\r':
+			if i+1 < len(content) && content[i+1] == '\n' {
+				le = le.combine(CRLF)
+				i++
+			} else {
+				le = le.combine(CR)
+			}
+		default:
+			continue
+		}
+		if le == MixedLineEndings {
+			break
+		}
+	}
+	return le
+}
+
+func detectFormat(content []byte) TextFormat {
+	return TextFormat{
+		LineEnding: detectLineEnding(content),
+		Encoding:   UTF8,
+		BOM:        bytes.HasPrefix(content, utf8BOM),
+	}
+}
+
+// normalizeLineEndings converts CRLF and CR line endings to LF.
+// The content is returned as-is if it contains no CR characters.
+func normalizeLineEndings(content []byte) []byte {
+	if bytes.IndexByte(content, '\r') < 0 {
+		return content
+	}
+	res := make([]byte, 0, len(content))
+	for i := 0; i < len(content); i++ {
+		if content[i] != '\r' {
+			res = append(res, content[i])
+			continue
+		}
+		res = append(res, '\n')
+		if i+1 < len(content) && content[i+1] == '\n' {
+			i++
+		}
+	}
+	return res
+}
+
+// normalizeText applies the configured line ending policy to a text. It must be applied to a complete content, since
+// a line ending may be split between the fragments.
+func (c *Cache) normalizeText(text []byte) []byte {
+	if c.lineEndings == NormalizeLineEndings {
+		return normalizeLineEndings(text)
+	}
+	return text
+}
+
+// normalizeContent detects the format of a complete saved content, and applies the configured policies to it.
+func (c *Cache) normalizeContent(content []byte) ([]byte, TextFormat) {
+	tf := detectFormat(content)
+	if tf.BOM && c.bom == StripBOM {
+		content = content[len(utf8BOM):]
+	}
+	return c.normalizeText(content), tf
+}
@@ -0,0 +1,291 @@
+package lsp_srv_ex
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+// CapabilityConflictPolicy determines how the conflicts between the server capabilities set by the server, and the
+// ones contributed through `Helper.AddCapabilities`, are handled.
+type CapabilityConflictPolicy int
+
+const (
+	// LogCapabilityConflicts logs the conflicts, and keeps the value set by the server (or by the contributor added
+	// first), unless the contributor requires its value (see `Helper.RequireCapabilities`).
+	LogCapabilityConflicts CapabilityConflictPolicy = iota
+	// RejectCapabilityConflicts fails `initialize` request with `jsonrpc2.ErrInternal` on the first conflict.
+	RejectCapabilityConflicts
+)
+
+func (p CapabilityConflictPolicy) String() string {
+	switch p {
+	case LogCapabilityConflicts:
+		return "LogCapabilityConflicts"
+	case RejectCapabilityConflicts:
+		return "RejectCapabilityConflicts"
+	default:
+		return fmt.Sprintf("Unknown capability conflict policy %d", p)
+	}
+}
+
+// capabilityContributor is a source of server capabilities, added by `Helper.AddCapabilities`.
+type capabilityContributor struct {
+	source   string
+	fn       func() *protocol.ServerCapabilities
+	required bool // the contributed values win the conflicts
+}
+
+// AddCapabilities adds a contributor of server capabilities. `fn` is called while handling `initialize` request,
+// after the server has handled it, so it can use the client capabilities. The returned capabilities are merged into
+// the ones set by the server, in the order the contributors are added:
+//   - the values missing from the result are added;
+//   - the objects are merged recursively;
+//   - the arrays are merged, skipping the duplicates;
+//   - `true` is replaced by an object (e.g. `"hoverProvider": true` and `"hoverProvider": {}`);
+//   - the `TextDocumentSyncKind` form of `textDocumentSync` is converted to `TextDocumentSyncOptions`.
+//
+// Any other difference is a conflict, handled according to `Config.CapabilityConflicts`. `source` identifies the
+// contributor in the logs and errors. Must be called before `initialize` request is received.
+func (h *Helper) AddCapabilities(source string, fn func() *protocol.ServerCapabilities) {
+	h.addContributor(capabilityContributor{source: source, fn: fn})
+}
+
+// RequireCapabilities is like `AddCapabilities`, but for the capabilities a feature can't work without (e.g. the
+// cache requires `openClose` and incremental `change`). With `LogCapabilityConflicts`, the contributed values replace
+// the conflicting ones, and the conflicts are logged.
+func (h *Helper) RequireCapabilities(source string, fn func() *protocol.ServerCapabilities) {
+	h.addContributor(capabilityContributor{source: source, fn: fn, required: true})
+}
+
+func (h *Helper) addContributor(c capabilityContributor) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	h.contributors = append(h.contributors, c)
+}
+
+// ServerCapabilities returns the server capabilities sent to the client in the response to `initialize` request, or
+// `nil` if it isn't sent yet. The returned instance must not be modified. The interface-typed fields (like
+// `HoverProvider`) keep the types set by the server or the contributors, unless their values are merged into a value
+// none of these types can hold, in which case they are `map[string]interface{}`.
+func (h *Helper) ServerCapabilities() *protocol.ServerCapabilities {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	return h.serverCaps
+}
+
+// buildCapabilities merges the capabilities of all the contributors into `res`.
+func (h *Helper) buildCapabilities(res *protocol.InitializeResult) (*protocol.InitializeResult, error) {
+	if res == nil {
+		res = &protocol.InitializeResult{}
+	}
+
+	h.statusLock.Lock()
+	contributors := h.contributors
+	h.statusLock.Unlock()
+
+	if len(contributors) > 0 {
+		merged, err := capabilitiesToMap(&res.Capabilities)
+		if err != nil {
+			return nil, fmt.Errorf("%w: server capabilities: %v", jsonrpc2.ErrInternal, err)
+		}
+
+		sources := []*protocol.ServerCapabilities{&res.Capabilities}
+		for _, c := range contributors {
+			caps := c.fn()
+			if caps == nil {
+				continue
+			}
+			sources = append(sources, caps)
+			m, err := capabilitiesToMap(caps)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s capabilities: %v", jsonrpc2.ErrInternal, c.source, err)
+			}
+			for _, conflict := range mergeCapabilities(merged, m, nil, c.required) {
+				if h.capabilityConflicts == RejectCapabilityConflicts {
+					return nil, fmt.Errorf("%w: %s capabilities: conflict at %s", jsonrpc2.ErrInternal, c.source,
+						conflict)
+				}
+				h.logger.Warn("capability conflict", zap.String("source", c.source), zap.String("path", conflict),
+					zap.Bool("required", c.required))
+			}
+		}
+
+		caps, err := typedCapabilities(merged, sources)
+		if err != nil {
+			return nil, fmt.Errorf("%w: merged capabilities: %v", jsonrpc2.ErrInternal, err)
+		}
+		res.Capabilities = *caps
+	}
+
+	h.statusLock.Lock()
+	h.serverCaps = &res.Capabilities
+	h.statusLock.Unlock()
+
+	return res, nil
+}
+
+// capabilitiesToMap converts the capabilities to their JSON representation.
+func capabilitiesToMap(caps *protocol.ServerCapabilities) (map[string]interface{}, error) {
+	data, err := json.Marshal(caps)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	if kind, ok := m["textDocumentSync"].(float64); ok {
+		m["textDocumentSync"] = map[string]interface{}{
+			"openClose": kind != float64(protocol.None),
+			"change":    kind,
+		}
+	}
+	return m, nil
+}
+
+// mergeCapabilities merges `src` into `dst`, and returns the paths of the conflicting values, which are left as they
+// are in `dst`, or replaced by the ones from `src` if `override` is set. The keys are processed in the sorted order,
+// so the result is deterministic.
+func mergeCapabilities(dst, src map[string]interface{}, path []string, override bool) (conflicts []string) {
+	keys := make([]string, 0, len(src))
+	for k := range src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p := append(path[:len(path):len(path)], k)
+		sv := src[k]
+		dv, ok := dst[k]
+		if !ok || dv == nil {
+			dst[k] = sv
+			continue
+		}
+		if sv == nil || reflect.DeepEqual(dv, sv) {
+			continue
+		}
+
+		switch d := dv.(type) {
+		case map[string]interface{}:
+			switch s := sv.(type) {
+			case map[string]interface{}:
+				conflicts = append(conflicts, mergeCapabilities(d, s, p, override)...)
+				continue
+			case bool:
+				if s {
+					continue
+				}
+			}
+		case []interface{}:
+			if s, ok := sv.([]interface{}); ok {
+				dst[k] = mergeArrays(d, s)
+				continue
+			}
+		case bool:
+			if _, ok := sv.(map[string]interface{}); ok && d {
+				dst[k] = sv
+				continue
+			}
+		}
+		if override {
+			dst[k] = sv
+		}
+		conflicts = append(conflicts, strings.Join(p, "."))
+	}
+
+	return conflicts
+}
+
+// mergeArrays appends the elements of `src` missing from `dst` to it.
+func mergeArrays(dst, src []interface{}) []interface{} {
+	for _, s := range src {
+		found := false
+		for _, d := range dst {
+			if reflect.DeepEqual(d, s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// capabilityTypes are the types the interface-typed capabilities are decoded into if none of the source types can hold
+// the merged value, e.g. `textDocumentSync` converted from `TextDocumentSyncKind`.
+var capabilityTypes = map[string]reflect.Type{
+	"textDocumentSync": reflect.TypeOf(&protocol.TextDocumentSyncOptions{}),
+}
+
+// typedCapabilities converts the merged capabilities to `protocol.ServerCapabilities`. Decoded from JSON, the
+// interface-typed fields would be `map[string]interface{}`, so each of them is decoded into the type of the value set
+// by the contributors or the server, the last added first, which holds the merged value exactly.
+func typedCapabilities(merged map[string]interface{}, sources []*protocol.ServerCapabilities) (
+	*protocol.ServerCapabilities, error) {
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var caps protocol.ServerCapabilities
+	if err = json.Unmarshal(data, &caps); err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(&caps).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		mv := merged[name]
+		if f.Type.Kind() != reflect.Interface || mv == nil {
+			continue
+		}
+		want, err := json.Marshal(mv)
+		if err != nil {
+			return nil, err
+		}
+
+		var types []reflect.Type
+		for j := len(sources) - 1; j >= 0; j-- {
+			if sv := reflect.ValueOf(sources[j]).Elem().Field(i); !sv.IsNil() {
+				types = append(types, sv.Elem().Type())
+			}
+		}
+		if t, ok := capabilityTypes[name]; ok {
+			types = append(types, t)
+		}
+		for _, t := range types {
+			if tv, ok := decodeExactly(want, t); ok {
+				v.Field(i).Set(tv)
+				break
+			}
+		}
+	}
+	return &caps, nil
+}
+
+// decodeExactly decodes `data` into a value of type `t`, and returns `false` if it can't, or if the value doesn't
+// represent `data` exactly.
+func decodeExactly(data []byte, t reflect.Type) (reflect.Value, bool) {
+	pv := reflect.New(t)
+	if err := json.Unmarshal(data, pv.Interface()); err != nil {
+		return reflect.Value{}, false
+	}
+	got, err := json.Marshal(pv.Elem().Interface())
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	var a, b interface{}
+	if json.Unmarshal(data, &a) != nil || json.Unmarshal(got, &b) != nil || !reflect.DeepEqual(a, b) {
+		return reflect.Value{}, false
+	}
+	return pv.Elem(), true
+}
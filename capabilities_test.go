@@ -0,0 +1,109 @@
+package lsp_srv_ex
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+func TestBuildCapabilities(t *testing.T) {
+	cacheCaps := func() *protocol.ServerCapabilities {
+		return (&Cache{}).capabilities()
+	}
+	tests := []struct {
+		name    string
+		policy  CapabilityConflictPolicy
+		server  protocol.ServerCapabilities
+		add     func(h *Helper)
+		want    protocol.ServerCapabilities
+		wantErr error
+	}{
+		{
+			name:   "required sync replaces None",
+			server: protocol.ServerCapabilities{TextDocumentSync: protocol.None, HoverProvider: true},
+			add:    func(h *Helper) { h.RequireCapabilities("cache", cacheCaps) },
+			want: protocol.ServerCapabilities{
+				TextDocumentSync: &protocol.TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    protocol.Incremental,
+					Save:      &protocol.SaveOptions{},
+				},
+				HoverProvider: true,
+			},
+		},
+		{
+			name:   "required sync replaces full",
+			server: protocol.ServerCapabilities{TextDocumentSync: &protocol.TextDocumentSyncOptions{Change: protocol.Full}},
+			add:    func(h *Helper) { h.RequireCapabilities("cache", cacheCaps) },
+			want: protocol.ServerCapabilities{
+				TextDocumentSync: &protocol.TextDocumentSyncOptions{
+					OpenClose: true,
+					Change:    protocol.Incremental,
+					Save:      &protocol.SaveOptions{},
+				},
+			},
+		},
+		{
+			name:    "required conflict rejected",
+			policy:  RejectCapabilityConflicts,
+			server:  protocol.ServerCapabilities{TextDocumentSync: protocol.None},
+			add:     func(h *Helper) { h.RequireCapabilities("cache", cacheCaps) },
+			wantErr: jsonrpc2.ErrInternal,
+		},
+		{
+			name:   "server value kept",
+			server: protocol.ServerCapabilities{TextDocumentSync: protocol.Full},
+			add: func(h *Helper) {
+				h.AddCapabilities("other", func() *protocol.ServerCapabilities {
+					return &protocol.ServerCapabilities{
+						TextDocumentSync: &protocol.TextDocumentSyncOptions{Change: protocol.Incremental},
+					}
+				})
+			},
+			want: protocol.ServerCapabilities{
+				TextDocumentSync: &protocol.TextDocumentSyncOptions{OpenClose: true, Change: protocol.Full},
+			},
+		},
+		{
+			name:   "typed values kept",
+			server: protocol.ServerCapabilities{HoverProvider: true},
+			add: func(h *Helper) {
+				h.AddCapabilities("diagnostics", func() *protocol.ServerCapabilities {
+					return &protocol.ServerCapabilities{
+						DiagnosticProvider: &protocol.DiagnosticOptions{InterFileDependencies: true},
+					}
+				})
+			},
+			want: protocol.ServerCapabilities{
+				HoverProvider:      true,
+				DiagnosticProvider: &protocol.DiagnosticOptions{InterFileDependencies: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHelper(nil, zap.NewNop())
+			h.contributors = nil
+			h.capabilityConflicts = tt.policy
+			tt.add(h)
+
+			res, err := h.buildCapabilities(&protocol.InitializeResult{Capabilities: tt.server})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res.Capabilities, tt.want) {
+				t.Fatalf("capabilities = %#v, want %#v", res.Capabilities, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package lsp_srv_ex
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// clientInfo keeps the parameters of `initialize` request.
+type clientInfo struct {
+	params *protocol.ParamInitialize
+	// raw is the JSON representation of `params`, used for the generic lookups.
+	raw map[string]interface{}
+}
+
+func (h *Helper) setClientInfo(params *protocol.ParamInitialize) {
+	ci := &clientInfo{params: params}
+	if data, err := json.Marshal(params); err == nil {
+		_ = json.Unmarshal(data, &ci.raw)
+	} else {
+		h.logger.Warn("setClientInfo", zap.Error(err))
+	}
+
+	h.clientMu.Lock()
+	h.client = ci
+	h.clientMu.Unlock()
+}
+
+// lookup returns the value at `path` in the JSON representation of `initialize` parameters.
+func (h *Helper) lookup(path ...string) (interface{}, bool) {
+	h.clientMu.RLock()
+	defer h.clientMu.RUnlock()
+
+	if h.client == nil {
+		return nil, false
+	}
+	var v interface{} = h.client.raw
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return v, v != nil
+}
+
+func (h *Helper) lookupString(path ...string) string {
+	v, _ := h.lookup(path...)
+	s, _ := v.(string)
+	return s
+}
+
+// InitializeParams returns the parameters of `initialize` request, or `nil` if it isn't received yet.
+// The returned instance must not be modified.
+func (h *Helper) InitializeParams() *protocol.ParamInitialize {
+	h.clientMu.RLock()
+	defer h.clientMu.RUnlock()
+
+	if h.client == nil {
+		return nil
+	}
+	return h.client.params
+}
+
+// ClientCapabilities returns the capabilities sent by the client in `initialize` request.
+func (h *Helper) ClientCapabilities() protocol.ClientCapabilities {
+	if p := h.InitializeParams(); p != nil {
+		return p.Capabilities
+	}
+	return protocol.ClientCapabilities{}
+}
+
+// ClientCapability returns the value of the client capability at `path`, like
+// `ClientCapability("textDocument", "hover", "contentFormat")`. The value is decoded from JSON, so objects are
+// `map[string]interface{}`, arrays are `[]interface{}`, and numbers are `float64`.
+func (h *Helper) ClientCapability(path ...string) (interface{}, bool) {
+	return h.lookup(append([]string{"capabilities"}, path...)...)
+}
+
+// ClientSupports returns `true` if the boolean client capability at `path` is set, like
+// `ClientSupports("workspace", "applyEdit")`.
+func (h *Helper) ClientSupports(path ...string) bool {
+	v, _ := h.ClientCapability(path...)
+	b, _ := v.(bool)
+	return b
+}
+
+// ClientName returns the name of the client, if provided.
+func (h *Helper) ClientName() string {
+	return h.lookupString("clientInfo", "name")
+}
+
+// ClientVersion returns the version of the client, if provided.
+func (h *Helper) ClientVersion() string {
+	return h.lookupString("clientInfo", "version")
+}
+
+// Locale returns the locale of the client user interface, if provided.
+func (h *Helper) Locale() string {
+	return h.lookupString("locale")
+}
+
+// InitialTrace returns the trace setting sent in `initialize` request: "off", "messages" or "verbose".
+func (h *Helper) InitialTrace() string {
+	if t := h.lookupString("trace"); t != "" {
+		return t
+	}
+	return "off"
+}
+
+// InitializationOptions returns the initialization options sent by the client, decoded from JSON.
+func (h *Helper) InitializationOptions() interface{} {
+	v, _ := h.lookup("initializationOptions")
+	return v
+}
+
+// DecodeInitializationOptions decodes the initialization options sent by the client into `v`, which should be a
+// pointer, like for `json.Unmarshal`. `v` is left unchanged if there are no initialization options.
+func (h *Helper) DecodeInitializationOptions(v interface{}) error {
+	opts := h.InitializationOptions()
+	if opts == nil {
+		return nil
+	}
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SupportsWorkDoneProgress returns `true` if the client supports server initiated work done progress.
+func (h *Helper) SupportsWorkDoneProgress() bool {
+	return h.ClientSupports("window", "workDoneProgress")
+}
+
+// SupportsShowDocument returns `true` if the client supports `window/showDocument` request.
+func (h *Helper) SupportsShowDocument() bool {
+	return h.ClientSupports("window", "showDocument", "support")
+}
+
+// SupportsConfiguration returns `true` if the client supports `workspace/configuration` request.
+func (h *Helper) SupportsConfiguration() bool {
+	return h.ClientSupports("workspace", "configuration")
+}
+
+// SupportsWorkspaceFolders returns `true` if the client supports workspace folders.
+func (h *Helper) SupportsWorkspaceFolders() bool {
+	return h.ClientSupports("workspace", "workspaceFolders")
+}
+
+// SupportsApplyEdit returns `true` if the client supports `workspace/applyEdit` request.
+func (h *Helper) SupportsApplyEdit() bool {
+	return h.ClientSupports("workspace", "applyEdit")
+}
+
+// SupportsSnippets returns `true` if the client supports snippets in completion items.
+func (h *Helper) SupportsSnippets() bool {
+	return h.ClientSupports("textDocument", "completion", "completionItem", "snippetSupport")
+}
+
+// SupportsMarkdownHover returns `true` if the client supports markdown content in hover results.
+func (h *Helper) SupportsMarkdownHover() bool {
+	v, _ := h.ClientCapability("textDocument", "hover", "contentFormat")
+	formats, _ := v.([]interface{})
+	for _, f := range formats {
+		if f == string(protocol.Markdown) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsDynamicRegistration returns `true` if the client supports dynamic registration of the capability for
+// `method`, like `MethodDidChangeWatchedFiles`.
+func (h *Helper) SupportsDynamicRegistration(method string) bool {
+	path := dynamicRegistrationPath(method)
+	return path != nil && h.ClientSupports(path...)
+}
+
+// dynamicRegistrationPath returns the path of `dynamicRegistration` client capability for `method`, or `nil` if
+// unknown.
+func dynamicRegistrationPath(method string) []string {
+	switch method {
+	case MethodDidOpen, MethodDidChange, MethodDidClose, MethodDidSave, MethodWillSave, MethodWillSaveWaitUntil:
+		return []string{"textDocument", "synchronization", "dynamicRegistration"}
+	case MethodSemanticTokensFull, MethodSemanticTokensFullDelta, MethodSemanticTokensRange:
+		return []string{"textDocument", "semanticTokens", "dynamicRegistration"}
+	case MethodPrepareRename:
+		return []string{"textDocument", "rename", "dynamicRegistration"}
+	case MethodDocumentColor, MethodColorPresentation:
+		return []string{"textDocument", "colorProvider", "dynamicRegistration"}
+	case MethodDiagnosticWorkspace:
+		return []string{"textDocument", "diagnostic", "dynamicRegistration"}
+	case MethodPrepareCallHierarchy:
+		return []string{"textDocument", "callHierarchy", "dynamicRegistration"}
+	case MethodPrepareTypeHierarchy:
+		return []string{"textDocument", "typeHierarchy", "dynamicRegistration"}
+	case MethodDidCreateFiles, MethodDidRenameFiles, MethodDidDeleteFiles, MethodWillCreateFiles,
+		MethodWillRenameFiles, MethodWillDeleteFiles:
+		return []string{"workspace", "fileOperations", "dynamicRegistration"}
+	case MethodDidOpenNotebookDocument, MethodDidChangeNotebookDocument, MethodDidSaveNotebookDocument,
+		MethodDidCloseNotebookDocument:
+		return []string{"notebookDocument", "synchronization", "dynamicRegistration"}
+	}
+
+	parts := strings.Split(method, "/")
+	if len(parts) != 2 || (parts[0] != "textDocument" && parts[0] != "workspace") {
+		return nil
+	}
+	return []string{parts[0], parts[1], "dynamicRegistration"}
+}
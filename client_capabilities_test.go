@@ -0,0 +1,37 @@
+package lsp_srv_ex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDynamicRegistrationPath(t *testing.T) {
+	tests := []struct {
+		method string
+		want   []string
+	}{
+		{MethodDidOpen, []string{"textDocument", "synchronization", "dynamicRegistration"}},
+		{MethodWillSaveWaitUntil, []string{"textDocument", "synchronization", "dynamicRegistration"}},
+		{MethodHover, []string{"textDocument", "hover", "dynamicRegistration"}},
+		{MethodRename, []string{"textDocument", "rename", "dynamicRegistration"}},
+		{MethodPrepareRename, []string{"textDocument", "rename", "dynamicRegistration"}},
+		{MethodDocumentColor, []string{"textDocument", "colorProvider", "dynamicRegistration"}},
+		{MethodColorPresentation, []string{"textDocument", "colorProvider", "dynamicRegistration"}},
+		{MethodDiagnostic, []string{"textDocument", "diagnostic", "dynamicRegistration"}},
+		{MethodDiagnosticWorkspace, []string{"textDocument", "diagnostic", "dynamicRegistration"}},
+		{MethodSemanticTokensRange, []string{"textDocument", "semanticTokens", "dynamicRegistration"}},
+		{MethodPrepareCallHierarchy, []string{"textDocument", "callHierarchy", "dynamicRegistration"}},
+		{MethodPrepareTypeHierarchy, []string{"textDocument", "typeHierarchy", "dynamicRegistration"}},
+		{MethodDidRenameFiles, []string{"workspace", "fileOperations", "dynamicRegistration"}},
+		{MethodDidCloseNotebookDocument, []string{"notebookDocument", "synchronization", "dynamicRegistration"}},
+		{MethodDidChangeConfiguration, []string{"workspace", "didChangeConfiguration", "dynamicRegistration"}},
+		{MethodExecuteCommand, []string{"workspace", "executeCommand", "dynamicRegistration"}},
+		{MethodInitialize, nil},
+		{"$/custom", nil},
+	}
+	for _, tt := range tests {
+		if got := dynamicRegistrationPath(tt.method); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dynamicRegistrationPath(%q) = %v, want %v", tt.method, got, tt.want)
+		}
+	}
+}
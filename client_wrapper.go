@@ -11,110 +11,114 @@ import (
 type clientWrapper struct {
 	inner  protocol.ClientCloser
 	helper *Helper
+
+	// handler is the middleware chain every outgoing request and notification is passed through.
+	handler Handler
+
 	logger *zap.Logger
 }
 
+// NewClientWrapper wraps `inner`. The calls are passed through `Config.ClientMiddlewares` of the config `helper` was
+// created with.
 func NewClientWrapper(inner protocol.ClientCloser, helper *Helper, lgr *zap.Logger) protocol.ClientCloser {
+	mws := []Middleware{tracingMiddleware(helper.sessionTracer(), clientSpan), loggingMiddleware(lgr)}
+	if helper != nil {
+		mws = append(mws, helper.clientMiddlewares...)
+	}
 	return &clientWrapper{
-		inner:  inner,
-		helper: helper,
-		logger: lgr,
+		inner:   inner,
+		helper:  helper,
+		handler: newChain(mws...),
+		logger:  lgr,
 	}
 }
 
 func (c *clientWrapper) LogTrace(ctx context.Context, params *protocol.LogTraceParams) error {
-	c.logger.Debug("LogTrace", zap.Any("params", params))
-	return c.inner.LogTrace(ctx, params)
+	return notify(ctx, c.handler, MethodLogTrace, params, c.inner.LogTrace)
 }
 
 func (c *clientWrapper) Progress(ctx context.Context, params *protocol.ProgressParams) error {
-	c.logger.Debug("Progress", zap.Any("params", params))
-	return c.inner.Progress(ctx, params)
+	return notify(ctx, c.handler, MethodProgress, params, c.inner.Progress)
 }
 
 func (c *clientWrapper) RegisterCapability(ctx context.Context, params *protocol.RegistrationParams) error {
-	c.logger.Debug("RegisterCapability", zap.Any("params", params))
-	return c.inner.RegisterCapability(ctx, params)
+	return callNoResult(ctx, c.handler, MethodRegisterCapability, params, c.inner.RegisterCapability)
 }
 
 func (c *clientWrapper) UnregisterCapability(ctx context.Context, params *protocol.UnregistrationParams) error {
-	c.logger.Debug("UnregisterCapability", zap.Any("params", params))
-	return c.inner.UnregisterCapability(ctx, params)
+	return callNoResult(ctx, c.handler, MethodUnregisterCapability, params, c.inner.UnregisterCapability)
 }
 
 func (c *clientWrapper) Event(ctx context.Context, params *interface{}) error {
-	c.logger.Debug("Event", zap.Any("params", params))
-	return c.inner.Event(ctx, params)
+	return notify(ctx, c.handler, MethodEvent, params, c.inner.Event)
 }
 
 func (c *clientWrapper) PublishDiagnostics(ctx context.Context, params *protocol.PublishDiagnosticsParams) error {
-	c.logger.Debug("PublishDiagnostics", zap.Any("params", params))
-	return c.inner.PublishDiagnostics(ctx, params)
+	return notify(ctx, c.handler, MethodPublishDiagnostics, params, c.inner.PublishDiagnostics)
 }
 
 func (c *clientWrapper) LogMessage(ctx context.Context, params *protocol.LogMessageParams) error {
-	c.logger.Debug("LogMessage", zap.Any("params", params))
-	return c.inner.LogMessage(ctx, params)
+	return notify(ctx, c.handler, MethodLogMessage, params, c.inner.LogMessage)
 }
 
 func (c *clientWrapper) ShowDocument(ctx context.Context, params *protocol.ShowDocumentParams) (*protocol.ShowDocumentResult, error) {
-	c.logger.Debug("ShowDocument", zap.Any("params", params))
-	return c.inner.ShowDocument(ctx, params)
+	return call(ctx, c.handler, MethodShowDocument, params, c.inner.ShowDocument)
 }
 
 func (c *clientWrapper) ShowMessage(ctx context.Context, params *protocol.ShowMessageParams) error {
-	c.logger.Debug("ShowMessage", zap.Any("params", params))
-	return c.inner.ShowMessage(ctx, params)
+	return notify(ctx, c.handler, MethodShowMessage, params, c.inner.ShowMessage)
 }
 
 func (c *clientWrapper) ShowMessageRequest(ctx context.Context, params *protocol.ShowMessageRequestParams) (*protocol.MessageActionItem, error) {
-	c.logger.Debug("ShowMessageRequest", zap.Any("params", params))
-	return c.inner.ShowMessageRequest(ctx, params)
+	return call(ctx, c.handler, MethodShowMessageRequest, params, c.inner.ShowMessageRequest)
 }
 
 func (c *clientWrapper) WorkDoneProgressCreate(ctx context.Context, params *protocol.WorkDoneProgressCreateParams) error {
-	c.logger.Debug("WorkDoneProgressCreate", zap.Any("params", params))
-	return c.inner.WorkDoneProgressCreate(ctx, params)
+	return callNoResult(ctx, c.handler, MethodWorkDoneProgressCreate, params, c.inner.WorkDoneProgressCreate)
 }
 
 func (c *clientWrapper) ApplyEdit(ctx context.Context, params *protocol.ApplyWorkspaceEditParams) (*protocol.ApplyWorkspaceEditResult, error) {
-	c.logger.Debug("ApplyEdit", zap.Any("params", params))
-	return c.inner.ApplyEdit(ctx, params)
+	return call(ctx, c.handler, MethodApplyEdit, params, c.inner.ApplyEdit)
 }
 
 func (c *clientWrapper) CodeLensRefresh(ctx context.Context) error {
-	c.logger.Debug("CodeLensRefresh")
-	return c.inner.CodeLensRefresh(ctx)
+	return callNoResult(ctx, c.handler, MethodCodeLensRefresh, nil, func(ctx context.Context, _ interface{}) error {
+		return c.inner.CodeLensRefresh(ctx)
+	})
 }
 
 func (c *clientWrapper) Configuration(ctx context.Context, params *protocol.ParamConfiguration) ([]protocol.LSPAny, error) {
-	c.logger.Debug("Configuration", zap.Any("params", params))
-	return c.inner.Configuration(ctx, params)
+	return call(ctx, c.handler, MethodConfiguration, params, c.inner.Configuration)
 }
 
 func (c *clientWrapper) DiagnosticRefresh(ctx context.Context) error {
-	c.logger.Debug("DiagnosticRefresh")
-	return c.inner.DiagnosticRefresh(ctx)
+	return callNoResult(ctx, c.handler, MethodDiagnosticRefresh, nil, func(ctx context.Context, _ interface{}) error {
+		return c.inner.DiagnosticRefresh(ctx)
+	})
 }
 
 func (c *clientWrapper) InlayHintRefresh(ctx context.Context) error {
-	c.logger.Debug("InlayHintRefresh")
-	return c.inner.InlayHintRefresh(ctx)
+	return callNoResult(ctx, c.handler, MethodInlayHintRefresh, nil, func(ctx context.Context, _ interface{}) error {
+		return c.inner.InlayHintRefresh(ctx)
+	})
 }
 
 func (c *clientWrapper) InlineValueRefresh(ctx context.Context) error {
-	c.logger.Debug("InlineValueRefresh")
-	return c.inner.InlineValueRefresh(ctx)
+	return callNoResult(ctx, c.handler, MethodInlineValueRefresh, nil, func(ctx context.Context, _ interface{}) error {
+		return c.inner.InlineValueRefresh(ctx)
+	})
 }
 
 func (c *clientWrapper) SemanticTokensRefresh(ctx context.Context) error {
-	c.logger.Debug("SemanticTokensRefresh")
-	return c.inner.SemanticTokensRefresh(ctx)
+	return callNoResult(ctx, c.handler, MethodSemanticTokensRefresh, nil, func(ctx context.Context, _ interface{}) error {
+		return c.inner.SemanticTokensRefresh(ctx)
+	})
 }
 
 func (c *clientWrapper) WorkspaceFolders(ctx context.Context) ([]protocol.WorkspaceFolder, error) {
-	c.logger.Debug("WorkspaceFolders")
-	return c.inner.WorkspaceFolders(ctx)
+	return call(ctx, c.handler, MethodWorkspaceFolders, nil, func(ctx context.Context, _ interface{}) ([]protocol.WorkspaceFolder, error) {
+		return c.inner.WorkspaceFolders(ctx)
+	})
 }
 
 func (c *clientWrapper) Close() error {
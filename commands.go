@@ -0,0 +1,166 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/x-tools-internal/jsonrpc2"
+)
+
+// CommandOptions configures a command added by `AddCommand`.
+type CommandOptions struct {
+	// ProgressTitle is the title of the progress reported while the command is executed. If empty, the progress isn't
+	// reported, and the handler gets a `nil` reporter.
+	ProgressTitle string
+	// Cancellable allows the user to cancel the command through the progress. The cancellation cancels the context
+	// passed to the handler.
+	Cancellable bool
+}
+
+// command is a command added by `AddCommand`.
+type command struct {
+	opts CommandOptions
+	exec func(ctx context.Context, args []json.RawMessage, progress *ProgressReporter) (interface{}, error)
+}
+
+// AddCommand adds the handler of the command `name` for `workspace/executeCommand` request to `h`. `opts` may be `nil`.
+// The command is advertised in `executeCommandProvider` server capability, so it must be added before `initialize`
+// request.
+//
+// The arguments of the command are decoded into `A` from JSON: if `A` is a slice or an array, from all the arguments;
+// otherwise, from the single argument, if any. If the arguments can't be decoded, the request fails with
+// `jsonrpc2.ErrInvalidParams`.
+func AddCommand[A any, R any](h *Helper, name string,
+	handler func(ctx context.Context, args A, progress *ProgressReporter) (R, error), opts *CommandOptions) {
+	c := &command{
+		exec: func(ctx context.Context, raw []json.RawMessage, progress *ProgressReporter) (interface{}, error) {
+			args, err := decodeArguments[A](raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w: command %q: %v", jsonrpc2.ErrInvalidParams, name, err)
+			}
+			return handler(ctx, args, progress)
+		},
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+	if h.commands == nil {
+		h.commands = make(map[string]*command)
+	}
+	h.commands[name] = c
+}
+
+// decodeArguments decodes the command arguments into `A`.
+func decodeArguments[A any](raw []json.RawMessage) (A, error) {
+	var args A
+	switch reflect.TypeOf(&args).Elem().Kind() {
+	case reflect.Slice, reflect.Array:
+		if raw == nil {
+			return args, nil
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return args, err
+		}
+		return args, json.Unmarshal(data, &args)
+	default:
+		switch len(raw) {
+		case 0:
+			return args, nil
+		case 1:
+			return args, json.Unmarshal(raw[0], &args)
+		default:
+			return args, fmt.Errorf("expected at most 1 argument, got %d", len(raw))
+		}
+	}
+}
+
+// commandCapabilities advertises the added commands.
+func (h *Helper) commandCapabilities() *protocol.ServerCapabilities {
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+
+	if len(h.commands) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(h.commands))
+	for name := range h.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &protocol.ServerCapabilities{
+		ExecuteCommandProvider: &protocol.ExecuteCommandOptions{Commands: names},
+	}
+}
+
+// executeCommand executes the command added by `AddCommand`. It returns `false` if the command wasn't added, and
+// should be passed to the server if there's no error.
+func (h *Helper) executeCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, bool,
+	error) {
+	if params == nil {
+		return nil, true, fmt.Errorf("%w: executeCommand params == nil", jsonrpc2.ErrInvalidParams)
+	}
+
+	h.commandsMu.Lock()
+	c := h.commands[params.Command]
+	h.commandsMu.Unlock()
+
+	if c == nil {
+		return nil, false, h.unknownCommand(params.Command)
+	}
+
+	var progress *ProgressReporter
+	if c.opts.ProgressTitle != "" {
+		progress = h.StartProgress(ctx, c.opts.ProgressTitle, &ProgressOptions{
+			Token:       params.WorkDoneToken,
+			Cancellable: c.opts.Cancellable,
+		})
+		ctx = progress.Context()
+	}
+	res, err := c.exec(ctx, params.Arguments, progress)
+	progress.EndWithError(err)
+	return res, true, err
+}
+
+// unknownCommand returns the error for the command not added by `AddCommand`, or `nil` if the command is advertised
+// by the server, statically or by a dynamic registration.
+func (h *Helper) unknownCommand(name string) error {
+	commands := h.registeredCommands()
+	if caps := h.ServerCapabilities(); caps != nil && caps.ExecuteCommandProvider != nil {
+		commands = append(commands, caps.ExecuteCommandProvider.Commands...)
+	}
+	if len(commands) == 0 {
+		return fmt.Errorf("%w: no commands supported", jsonrpc2.ErrMethodNotFound)
+	}
+	for _, c := range commands {
+		if c == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown command %q", jsonrpc2.ErrInvalidParams, name)
+}
+
+// registeredCommands returns the commands of the current `workspace/executeCommand` registrations.
+func (h *Helper) registeredCommands() []string {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+
+	var commands []string
+	for _, r := range h.registrations {
+		if r.id == "" || r.capability.Method != MethodExecuteCommand {
+			continue
+		}
+		var opts protocol.ExecuteCommandOptions
+		if data, err := json.Marshal(r.options); err == nil && json.Unmarshal(data, &opts) == nil {
+			commands = append(commands, opts.Commands...)
+		}
+	}
+	return commands
+}
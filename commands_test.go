@@ -0,0 +1,67 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+func TestExecuteUnknownCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		static     []string
+		registered []string
+		wantErr    error
+	}{
+		{
+			name:    "nothing advertised",
+			wantErr: jsonrpc2.ErrMethodNotFound,
+		},
+		{
+			name:   "advertised statically",
+			static: []string{"other", "test.run"},
+		},
+		{
+			name:       "registered dynamically",
+			registered: []string{"test.run"},
+		},
+		{
+			name:       "not advertised",
+			static:     []string{"other"},
+			registered: []string{"another"},
+			wantErr:    jsonrpc2.ErrInvalidParams,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHelper(nil, zap.NewNop())
+			h.serverCaps = &protocol.ServerCapabilities{}
+			if tt.static != nil {
+				h.serverCaps.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{Commands: tt.static}
+			}
+			if tt.registered != nil {
+				h.registrations = append(h.registrations, &Registration{
+					helper:     h,
+					capability: DynamicCapability{Method: MethodExecuteCommand},
+					id:         "workspace/executeCommand#1",
+					options:    &protocol.ExecuteCommandOptions{Commands: tt.registered},
+				})
+			}
+
+			_, handled, err := h.executeCommand(context.Background(), &protocol.ExecuteCommandParams{Command: "test.run"})
+			if handled {
+				t.Fatal("unknown command handled")
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("err = %v, want nil", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
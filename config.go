@@ -20,7 +20,78 @@ type Config struct {
 
 	Caching bool `json:"caching"`
 
+	// LineEndings determines how the line endings of the cached content are handled. Used only if `Caching` is set.
+	LineEndings LineEndingPolicy `json:"lineEndings"`
+
+	// BOM determines how the UTF-8 byte order mark of the saved content is handled. The editor content is kept as the
+	// IDE sent it, since the positions count the BOM. Used only if `Caching` is set.
+	BOM BOMPolicy `json:"bom"`
+
+	// Encodings assigns encodings to the saved content of the files matching glob patterns. The first matching rule
+	// wins. The saved content is transcoded to UTF-8 when read. Used only if `Caching` is set.
+	Encodings []EncodingRule `json:"encodings"`
+
+	// DefaultEncoding is used for the saved content that isn't valid UTF-8, and isn't matched by any of the
+	// `Encodings` rules. If empty, such content is kept as-is. Used only if `Caching` is set.
+	DefaultEncoding Encoding `json:"defaultEncoding"`
+
+	// DiagnosticsDelay is the delay before the diagnostics set through `Helper.Diagnostics` are published, reset by
+	// every change of the document diagnostics. If zero, the diagnostics are published immediately.
+	DiagnosticsDelay time.Duration `json:"diagnosticsDelay"`
+
 	ZapConfig *zap.Config `json:"zapConfig"`
+
+	// ClientLog forwards the log entries of the session to the client through `window/logMessage` notifications. If
+	// `nil`, the entries aren't forwarded.
+	ClientLog *ClientLogOptions `json:"clientLog"`
+
+	// Tracing logs a span for every request and notification, received from or sent to the client, with its duration,
+	// outcome and payload sizes.
+	Tracing bool `json:"tracing"`
+
+	// TraceFile is the file the spans are exported to, in OpenTelemetry (OTLP) JSON format, one export request per
+	// line. If empty, the spans aren't exported.
+	TraceFile string `json:"traceFile"`
+
+	// Lifecycle determines how the messages received before `initialize`, or after `shutdown`, are handled.
+	Lifecycle LifecyclePolicy `json:"lifecycle"`
+
+	// CapabilityConflicts determines how the conflicts between the server capabilities set by the server, and the ones
+	// contributed through `Helper.AddCapabilities` (e.g. by the cache), are handled.
+	CapabilityConflicts CapabilityConflictPolicy `json:"capabilityConflicts"`
+
+	// RequestTimeout is the time the server has to respond to a request. After it expires, the request context is
+	// cancelled, and the request fails with `ErrRequestCancelled`. If zero, there's no timeout.
+	RequestTimeout time.Duration `json:"requestTimeout"`
+
+	// MethodTimeouts overrides `RequestTimeout` for the methods, like `MethodCompletion`. Zero means no timeout.
+	MethodTimeouts map[string]time.Duration `json:"methodTimeouts"`
+
+	// ContentModifiedMethods are the methods whose requests are cancelled, and fail with `ErrContentModified`, if the
+	// document they refer to changes while they are handled. If `nil`, `DefaultContentModifiedMethods` are used. Used
+	// only if `Caching` is set. The requests for these methods are handled concurrently with the messages received
+	// after them.
+	ContentModifiedMethods []string `json:"contentModifiedMethods"`
+
+	// Scheduling enables debouncing and coalescing of the requests for the methods, like `MethodDocumentHighlight`.
+	Scheduling map[string]SchedulePolicy `json:"scheduling"`
+
+	// Middlewares are called around every request and notification received from the client, in order: the first
+	// one is the outermost.
+	Middlewares []Middleware `json:"-"`
+
+	// ErrorMapper converts the errors returned by the server to the errors sent to the client. If `nil`,
+	// `DefaultErrorMapper` is used.
+	ErrorMapper ErrorMapper `json:"-"`
+
+	// ClientMiddlewares are called around every request and notification sent to the client, in order: the first
+	// one is the outermost.
+	ClientMiddlewares []Middleware `json:"-"`
+}
+
+// stdio returns `true` if the server communicates with a single client over stdin and stdout.
+func (c *Config) stdio() bool {
+	return c == nil || (c.Port == 0 && c.Address == "")
 }
 
 func (c *Config) toBaseConfig() *server.Config {
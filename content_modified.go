@@ -0,0 +1,131 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/lsp-srv/span"
+)
+
+// DefaultContentModifiedMethods are the methods used if `Config.ContentModifiedMethods` is `nil`: the requests sent
+// repeatedly while the user types, whose results are useless once the document changes.
+var DefaultContentModifiedMethods = []string{
+	MethodHover,
+	MethodCompletion,
+	MethodCodeAction,
+	MethodSemanticTokensFull,
+	MethodSemanticTokensFullDelta,
+	MethodSemanticTokensRange,
+}
+
+// inflightRequest is a request tracked by `contentModifiedMiddleware`.
+type inflightRequest struct {
+	cancel context.CancelFunc
+}
+
+// contentModifiedMiddleware fails the requests for the `methods` with `ErrContentModified` if the document they refer
+// to changes while they are handled, and cancels their context as soon as the change is received. It relies on the
+// cache for the document versions. The requests are handled asynchronously, so that the changes received meanwhile
+// aren't blocked by them.
+func contentModifiedMiddleware(helper *Helper, methods []string) Middleware {
+	if methods == nil {
+		methods = DefaultContentModifiedMethods
+	}
+	check := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		check[m] = true
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			if req.Notification || !check[req.Method] || helper.Cache == nil {
+				return next(ctx, req)
+			}
+			uri, ok := documentURI(req.Params)
+			if !ok {
+				return next(ctx, req)
+			}
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			su := uri.SpanURI()
+			r := &inflightRequest{cancel: cancel}
+			helper.trackRequest(su, r)
+			defer helper.untrackRequest(su, r)
+
+			before := documentVersion(helper.Cache, uri)
+			ctx = handleAsync(ctx)
+			res, err := next(ctx, req)
+			if documentVersion(helper.Cache, uri) != before {
+				return nil, fmt.Errorf("%w: %s: %s", ErrContentModified, req.Method, uri)
+			}
+			return res, err
+		}
+	}
+}
+
+func (h *Helper) trackRequest(su span.URI, r *inflightRequest) {
+	h.inflightMu.Lock()
+	defer h.inflightMu.Unlock()
+
+	if h.inflight == nil {
+		h.inflight = make(map[span.URI]map[*inflightRequest]struct{})
+	}
+	if h.inflight[su] == nil {
+		h.inflight[su] = make(map[*inflightRequest]struct{})
+	}
+	h.inflight[su][r] = struct{}{}
+}
+
+func (h *Helper) untrackRequest(su span.URI, r *inflightRequest) {
+	h.inflightMu.Lock()
+	defer h.inflightMu.Unlock()
+
+	delete(h.inflight[su], r)
+	if len(h.inflight[su]) == 0 {
+		delete(h.inflight, su)
+	}
+}
+
+// cancelStaleRequests cancels the context of the tracked requests for the document `uri`, which has just changed.
+func (h *Helper) cancelStaleRequests(uri protocol.DocumentURI) {
+	h.inflightMu.Lock()
+	defer h.inflightMu.Unlock()
+
+	for r := range h.inflight[uri.SpanURI()] {
+		r.cancel()
+	}
+}
+
+// documentVersion returns the version of the cached document, or -1 if it isn't cached.
+func documentVersion(c *Cache, uri protocol.DocumentURI) int32 {
+	return c.fileVersion(uri.SpanURI())
+}
+
+var documentURIType = reflect.TypeOf(protocol.DocumentURI(""))
+
+// documentURI returns the URI of the document the request params refer to, taken from `TextDocument.URI` field (like
+// in `protocol.TextDocumentPositionParams`).
+func documentURI(params interface{}) (protocol.DocumentURI, bool) {
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", false
+	}
+
+	td := v.FieldByName("TextDocument")
+	if !td.IsValid() || td.Kind() != reflect.Struct {
+		return "", false
+	}
+	uri := td.FieldByName("URI")
+	if !uri.IsValid() || uri.Type() != documentURIType {
+		return "", false
+	}
+	return uri.Interface().(protocol.DocumentURI), true
+}
@@ -0,0 +1,96 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+const testURI = protocol.DocumentURI("file:///test.go")
+
+// newContentModifiedHelper returns a helper with the document `testURI` cached at version 1.
+func newContentModifiedHelper() (*Helper, *file) {
+	h := newHelper(&Config{Caching: true}, zap.NewNop())
+	f := h.Cache.setFile(&file{parent: h.Cache, uri: testURI.SpanURI(), version: 1})
+	return h, f
+}
+
+func setVersion(f *file, version int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = version
+}
+
+func hoverRequest() *Request {
+	params := &protocol.HoverParams{}
+	params.TextDocument.URI = testURI
+	return &Request{Method: MethodHover, Params: params}
+}
+
+func TestContentModifiedUnchanged(t *testing.T) {
+	h, _ := newContentModifiedHelper()
+	next := func(context.Context, *Request) (interface{}, error) {
+		return "ok", nil
+	}
+
+	res, err := contentModifiedMiddleware(h, nil)(next)(context.Background(), hoverRequest())
+	if err != nil || res != "ok" {
+		t.Fatalf("res, err = %v, %v, want ok, nil", res, err)
+	}
+}
+
+func TestContentModifiedVersionBumped(t *testing.T) {
+	h, f := newContentModifiedHelper()
+	next := func(context.Context, *Request) (interface{}, error) {
+		// The document changes while the request is handled.
+		setVersion(f, 2)
+		return "ok", nil
+	}
+
+	res, err := contentModifiedMiddleware(h, nil)(next)(context.Background(), hoverRequest())
+	if !errors.Is(err, ErrContentModified) {
+		t.Fatalf("err = %v, want %v", err, ErrContentModified)
+	}
+	if res != nil {
+		t.Fatalf("res = %v, want nil", res)
+	}
+}
+
+func TestContentModifiedCancelled(t *testing.T) {
+	h, f := newContentModifiedHelper()
+	started := make(chan struct{})
+	next := func(ctx context.Context, _ *Request) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	go func() {
+		<-started
+		setVersion(f, 2)
+		h.cancelStaleRequests(testURI)
+	}()
+
+	_, err := contentModifiedMiddleware(h, nil)(next)(context.Background(), hoverRequest())
+	if !errors.Is(err, ErrContentModified) {
+		t.Fatalf("err = %v, want %v", err, ErrContentModified)
+	}
+}
+
+func TestContentModifiedOtherMethod(t *testing.T) {
+	h, f := newContentModifiedHelper()
+	next := func(context.Context, *Request) (interface{}, error) {
+		setVersion(f, 2)
+		return "ok", nil
+	}
+
+	req := hoverRequest()
+	req.Method = MethodDefinition
+	res, err := contentModifiedMiddleware(h, nil)(next)(context.Background(), req)
+	if err != nil || res != "ok" {
+		t.Fatalf("res, err = %v, %v, want ok, nil", res, err)
+	}
+}
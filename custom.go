@@ -0,0 +1,76 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+)
+
+// Validator is implemented by the params of custom methods that need to be validated after decoding. See
+// `HandleCustom`.
+type Validator interface {
+	Validate() error
+}
+
+// customHandler handles a custom method with the params decoded from JSON into `interface{}`.
+type customHandler func(ctx context.Context, params interface{}) (interface{}, error)
+
+// HandleCustom adds the handler of the custom (non-standard) method, like "$/myServer/status" or
+// "myServer/listTests", to `h`. The params are decoded into `P` from JSON, and validated if `*P` implements
+// `Validator`. If the params can't be decoded or are invalid, the request fails with `jsonrpc2.ErrInvalidParams`. For
+// notifications, the handler should return `nil` result.
+//
+// The custom methods without a handler that start with "$/" fail with `jsonrpc2.ErrMethodNotFound`, which is ignored
+// for notifications, as allowed by the specification. The others are passed to `protocol.Server.NonstandardRequest`.
+func HandleCustom[P any, R any](h *Helper, method string, handler func(ctx context.Context, params *P) (*R, error)) {
+	ch := func(ctx context.Context, raw interface{}) (interface{}, error) {
+		params := new(P)
+		if raw != nil {
+			data, err := json.Marshal(raw)
+			if err == nil {
+				err = json.Unmarshal(data, params)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", jsonrpc2.ErrInvalidParams, method, err)
+			}
+		}
+		if v, ok := interface{}(params).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", jsonrpc2.ErrInvalidParams, method, err)
+			}
+		}
+
+		res, err := handler(ctx, params)
+		if res == nil {
+			return nil, err
+		}
+		return res, err
+	}
+
+	h.customMu.Lock()
+	defer h.customMu.Unlock()
+	if h.custom == nil {
+		h.custom = make(map[string]customHandler)
+	}
+	h.custom[method] = ch
+}
+
+// handleCustom handles the custom method added by `HandleCustom`. It returns `false` if there's no handler, and the
+// method should be passed to the server.
+func (h *Helper) handleCustom(ctx context.Context, method string, params interface{}) (interface{}, bool, error) {
+	h.customMu.Lock()
+	ch := h.custom[method]
+	h.customMu.Unlock()
+
+	if ch != nil {
+		res, err := ch(ctx, params)
+		return res, true, err
+	}
+	if strings.HasPrefix(method, "$/") {
+		return nil, true, fmt.Errorf("%w: %s", jsonrpc2.ErrMethodNotFound, method)
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,266 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/lsp-srv/span"
+	"go.uber.org/zap"
+)
+
+// DiagnosticsManager keeps the diagnostics of the documents per source (e.g. an analyzer), and publishes the merged
+// diagnostics of each document to the client.
+type DiagnosticsManager struct {
+	helper *Helper
+	delay  time.Duration
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	docs map[span.URI]*documentDiagnostics
+}
+
+// documentDiagnostics are the diagnostics of a single document.
+type documentDiagnostics struct {
+	sources   map[string][]protocol.Diagnostic
+	version   int32 // the document version the diagnostics refer to
+	published []protocol.Diagnostic
+	timer     *time.Timer
+	ctx       context.Context // the context the diagnostics are published with
+}
+
+func newDiagnosticsManager(h *Helper, delay time.Duration, lgr *zap.Logger) *DiagnosticsManager {
+	m := &DiagnosticsManager{
+		helper: h,
+		delay:  delay,
+		docs:   make(map[span.URI]*documentDiagnostics),
+	}
+	if lgr != nil {
+		m.logger = lgr.With(zap.String("object", "DiagnosticsManager"))
+	}
+	return m
+}
+
+// Set replaces the diagnostics of the document `uri` from `source`, computed for the document `version`. If the cache
+// is used, `version` 0 means the current version of the document, and the diagnostics computed for an older version
+// are ignored. The diagnostics without `Source` get `source`.
+//
+// The merged diagnostics of the document are published after `Config.DiagnosticsDelay`, unless they are set again
+// meanwhile, and only if they differ from the ones published last.
+func (m *DiagnosticsManager) Set(ctx context.Context, uri protocol.DocumentURI, source string, version int32,
+	diagnostics []protocol.Diagnostic) {
+	su := uri.SpanURI()
+	if c := m.helper.Cache; c != nil {
+		if current, opened := c.openedVersion(su); opened {
+			if version == 0 {
+				version = current
+			} else if version < current {
+				m.logger.Debug("stale diagnostics", zap.String("uri", string(uri)), zap.String("source", source),
+					zap.Int32("version", version), zap.Int32("current", current))
+				return
+			}
+		}
+	}
+
+	ds := make([]protocol.Diagnostic, len(diagnostics))
+	for i, d := range diagnostics {
+		if d.Source == "" {
+			d.Source = source
+		}
+		ds[i] = d
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	doc := m.docs[su]
+	if doc == nil {
+		doc = &documentDiagnostics{sources: make(map[string][]protocol.Diagnostic)}
+		m.docs[su] = doc
+	}
+	if version != doc.version {
+		// The diagnostics of the other sources refer to another version of the document.
+		for s := range doc.sources {
+			if s != source {
+				delete(doc.sources, s)
+			}
+		}
+		doc.version = version
+	}
+	if len(ds) == 0 {
+		delete(doc.sources, source)
+	} else {
+		doc.sources[source] = ds
+	}
+	m.scheduleLocked(ctx, su, doc)
+}
+
+// Clear removes the diagnostics of the document `uri` from `source`.
+func (m *DiagnosticsManager) Clear(ctx context.Context, uri protocol.DocumentURI, source string) {
+	su := uri.SpanURI()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if doc := m.docs[su]; doc != nil {
+		delete(doc.sources, source)
+		m.scheduleLocked(ctx, su, doc)
+	}
+}
+
+// ClearAll removes all the diagnostics of the document `uri`, and publishes the empty set immediately.
+func (m *DiagnosticsManager) ClearAll(ctx context.Context, uri protocol.DocumentURI) {
+	m.clear(ctx, uri.SpanURI())
+}
+
+// Get returns the merged diagnostics of the document `uri`, and the document version they refer to.
+func (m *DiagnosticsManager) Get(uri protocol.DocumentURI) ([]protocol.Diagnostic, int32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if doc := m.docs[uri.SpanURI()]; doc != nil {
+		return doc.merged(), doc.version
+	}
+	return nil, 0
+}
+
+// Flush publishes all the pending diagnostics immediately.
+func (m *DiagnosticsManager) Flush(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for su, doc := range m.docs {
+		if doc.timer != nil && doc.timer.Stop() {
+			doc.timer = nil
+			m.publishLocked(ctx, su, doc)
+		}
+	}
+}
+
+func (m *DiagnosticsManager) clear(ctx context.Context, su span.URI) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	doc := m.docs[su]
+	if doc == nil {
+		return
+	}
+	if doc.timer != nil {
+		doc.timer.Stop()
+	}
+	delete(m.docs, su)
+	if len(doc.published) > 0 {
+		m.publishLocked(ctx, su, &documentDiagnostics{version: doc.version})
+	}
+}
+
+// stop stops all the pending publications.
+func (m *DiagnosticsManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, doc := range m.docs {
+		if doc.timer != nil {
+			doc.timer.Stop()
+			doc.timer = nil
+		}
+	}
+}
+
+func (m *DiagnosticsManager) scheduleLocked(ctx context.Context, su span.URI, doc *documentDiagnostics) {
+	// The publication may happen after the request or notification is handled.
+	doc.ctx = withoutCancel(ctx)
+
+	if m.delay <= 0 {
+		m.publishLocked(doc.ctx, su, doc)
+		return
+	}
+	if doc.timer != nil {
+		doc.timer.Stop()
+	}
+	doc.timer = time.AfterFunc(m.delay, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.docs[su] == doc {
+			doc.timer = nil
+			m.publishLocked(doc.ctx, su, doc)
+		}
+	})
+}
+
+func (m *DiagnosticsManager) publishLocked(ctx context.Context, su span.URI, doc *documentDiagnostics) {
+	merged := doc.merged()
+	if reflect.DeepEqual(merged, doc.published) {
+		return
+	}
+	doc.published = merged
+
+	if m.helper.clnt == nil {
+		return
+	}
+	err := m.helper.clnt.PublishDiagnostics(ctx, &protocol.PublishDiagnosticsParams{
+		URI:         protocol.URIFromSpanURI(su),
+		Version:     doc.version,
+		Diagnostics: merged,
+	})
+	if err != nil {
+		m.logger.Warn("PublishDiagnostics", zap.Error(err))
+	}
+}
+
+// merged returns the diagnostics of all the sources, ordered by the source name.
+func (doc *documentDiagnostics) merged() []protocol.Diagnostic {
+	sources := make([]string, 0, len(doc.sources))
+	for s := range doc.sources {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+
+	merged := []protocol.Diagnostic{}
+	for _, s := range sources {
+		merged = append(merged, doc.sources[s]...)
+	}
+	return merged
+}
+
+// didClose clears the diagnostics of a closed document.
+func (m *DiagnosticsManager) didClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) {
+	if params != nil {
+		m.clear(ctx, params.TextDocument.URI.SpanURI())
+	}
+}
+
+// didDeleteFiles clears the diagnostics of deleted files.
+func (m *DiagnosticsManager) didDeleteFiles(ctx context.Context, params *protocol.DeleteFilesParams) {
+	if params == nil {
+		return
+	}
+	for _, f := range params.Files {
+		m.clear(ctx, span.URI(f.URI))
+	}
+}
+
+// didRenameFiles clears the diagnostics of renamed files.
+func (m *DiagnosticsManager) didRenameFiles(ctx context.Context, params *protocol.RenameFilesParams) {
+	if params == nil {
+		return
+	}
+	for _, f := range params.Files {
+		m.clear(ctx, span.URI(f.OldURI))
+	}
+}
+
+// didChangeWatchedFiles clears the diagnostics of the files deleted outside the client.
+func (m *DiagnosticsManager) didChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) {
+	if params == nil {
+		return
+	}
+	for _, c := range params.Changes {
+		if c.Type == protocol.Deleted {
+			m.clear(ctx, c.URI.SpanURI())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+)
+
+// LSP specific error codes.
+var (
+	// ErrServerNotInitialized is returned for the requests received before `initialize`.
+	ErrServerNotInitialized = jsonrpc2.NewError(-32002, "JSON RPC server not initialized")
+	// ErrRequestCancelled is returned for the requests cancelled by the client, or by the server.
+	ErrRequestCancelled = jsonrpc2.NewError(-32800, "request cancelled")
+	// ErrContentModified is returned for the requests whose result is invalid because the document has changed.
+	ErrContentModified = jsonrpc2.NewError(-32801, "content modified")
+)
+
+// ErrorMapper converts the error returned by the server (or a middleware) to the error sent to the client. To keep its
+// code, the JSON-RPC error (like `jsonrpc2.ErrInvalidParams`) should be wrapped by the returned error.
+type ErrorMapper func(err error) error
+
+// wireErrorType is the type of the errors with a JSON-RPC error code.
+var wireErrorType = reflect.TypeOf(jsonrpc2.ErrInternal)
+
+// hasErrorCode returns `true` if `err` wraps an error with a JSON-RPC error code.
+func hasErrorCode(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if reflect.TypeOf(err) == wireErrorType {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultErrorMapper is the `ErrorMapper` used if `Config.ErrorMapper` isn't set. It keeps the errors with a JSON-RPC
+// error code, maps the context errors to `ErrRequestCancelled`, and all the other errors to `jsonrpc2.ErrInternal`.
+func DefaultErrorMapper(err error) error {
+	switch {
+	case err == nil || hasErrorCode(err):
+		return err
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %v", ErrRequestCancelled, err)
+	default:
+		return fmt.Errorf("%w: %v", jsonrpc2.ErrInternal, err)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/peske/lsp-srv v0.0.0-20230421124448-f55813a313b6
 	github.com/peske/x-tools-internal v0.0.0-20230421124625-d3edee47c0cb
 	go.uber.org/zap v1.24.0
+	golang.org/x/text v0.13.0
 )
 
 require (
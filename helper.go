@@ -1,9 +1,13 @@
 package lsp_srv_ex
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"github.com/peske/lsp-srv/span"
 	"go.uber.org/zap"
 )
 
@@ -15,6 +19,7 @@ const (
 	Initializing
 	Initialized
 	Shutdown
+	Exited
 )
 
 func (ss ServerStatus) String() string {
@@ -27,6 +32,8 @@ func (ss ServerStatus) String() string {
 		return "Initialized"
 	case Shutdown:
 		return "Shutdown"
+	case Exited:
+		return "Exited"
 	default:
 		return fmt.Sprintf("Unknown status %d", ss)
 	}
@@ -35,25 +42,96 @@ func (ss ServerStatus) String() string {
 type Helper struct {
 	statusLock sync.Mutex
 	status     ServerStatus
-	logger     *zap.Logger
+	cleanExit  bool // `exit` received after `shutdown`
+	hooks      map[ServerStatus][]func(ctx context.Context) error
+	watchers   []chan ServerStatus
+	cancel     func() // ends the session
+	tracer     *tracer
 
-	Cache *Cache
+	contributors        []capabilityContributor
+	capabilityConflicts CapabilityConflictPolicy
+	serverCaps          *protocol.ServerCapabilities // set on `initialize`
+
+	clnt              protocol.ClientCloser // used to send the requests to the client
+	clientMiddlewares []Middleware          // used by the client wrapper
+	regMu             sync.Mutex
+	regSeq            uint64 // the last generated registration ID
+	registrations     []*Registration
+
+	settingsMu sync.Mutex
+	settings   []settingsSection
+
+	progressMu  sync.Mutex
+	progressSeq uint64 // the last generated progress token
+	progress    map[string]*ProgressReporter
+
+	commandsMu sync.Mutex
+	commands   map[string]*command
+
+	customMu sync.Mutex
+	custom   map[string]customHandler
+
+	inflightMu sync.Mutex
+	inflight   map[span.URI]map[*inflightRequest]struct{} // requests cancelled when the document changes
+
+	clientMu sync.RWMutex
+	client   *clientInfo          // set on `initialize`
+	trace    protocol.TraceValues // set by `$/setTrace`
+
+	sessionLogger *zap.Logger
+	logger        *zap.Logger
+
+	Cache       *Cache
+	Diagnostics *DiagnosticsManager
 }
 
 func newHelper(cfg *Config, lgr *zap.Logger) *Helper {
 	h := &Helper{}
+	if cfg != nil {
+		h.capabilityConflicts = cfg.CapabilityConflicts
+		h.clientMiddlewares = cfg.ClientMiddlewares
+	}
 	if cfg != nil && cfg.Caching {
 		h.Cache = &Cache{
-			logger: lgr.With(zap.String("object", "Cache")),
+			logger:          lgr.With(zap.String("object", "Cache")),
+			lineEndings:     cfg.LineEndings,
+			bom:             cfg.BOM,
+			encodings:       cfg.Encodings,
+			defaultEncoding: cfg.DefaultEncoding,
 		}
 	}
 	if lgr != nil {
+		h.sessionLogger = lgr
 		h.logger = lgr.With(zap.String("object", "Helper"))
 	}
+	var delay time.Duration
+	if cfg != nil {
+		delay = cfg.DiagnosticsDelay
+	}
+	h.Diagnostics = newDiagnosticsManager(h, delay, lgr)
+	if h.Cache != nil {
+		h.RequireCapabilities("cache", h.Cache.capabilities)
+	}
+	h.AddCapabilities("commands", h.commandCapabilities)
+	h.AddCapabilities("registrations", h.staticCapabilities)
+	// Settings and registration errors are already logged, and shouldn't prevent the server from being
+	// (un)initialized. The settings are pulled first, since the registrations may depend on them.
+	h.OnInitialized(func(ctx context.Context) error {
+		_ = h.refreshSettings(ctx, nil)
+		_ = h.RefreshRegistrations(ctx)
+		return nil
+	})
+	h.OnShutdown(func(ctx context.Context) error {
+		h.Diagnostics.stop()
+		_ = h.unregisterAll(ctx)
+		return nil
+	})
 	return h
 }
 
-func (h *Helper) setStatus(status ServerStatus) (err error) {
+// setStatus changes the status, and returns the previous one. The watchers aren't notified, since the transition may
+// still be rolled back by `restoreStatus`.
+func (h *Helper) setStatus(status ServerStatus) (prev ServerStatus, err error) {
 	h.statusLock.Lock()
 	defer h.statusLock.Unlock()
 
@@ -66,16 +144,154 @@ func (h *Helper) setStatus(status ServerStatus) (err error) {
 		success = h.status == Initializing
 	case Shutdown:
 		success = h.status == Initialized
+	case Exited:
+		success = h.status != Exited
 	}
 
+	prev = h.status
 	if success {
+		if status == Exited {
+			h.cleanExit = h.status == Shutdown
+		}
 		h.status = status
 	} else {
 		err = fmt.Errorf("invalid status transition from '%s' to '%s'", h.status, status)
 		h.logger.Error("setStatus", zap.Error(err))
 	}
 
-	return err
+	return prev, err
+}
+
+// restoreStatus rolls back the transition from `prev` to `status`.
+func (h *Helper) restoreStatus(status, prev ServerStatus) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	if h.status == status {
+		h.status = prev
+	}
+}
+
+func (h *Helper) notifyWatchersLocked() {
+	for _, w := range h.watchers {
+		// The buffer is large enough for all the transitions, so this never blocks.
+		w <- h.status
+		if h.status == Exited {
+			close(w)
+		}
+	}
+	if h.status == Exited {
+		h.watchers = nil
+	}
+}
+
+// WatchStatus returns a channel that receives every subsequent status change, and a function that stops watching.
+// The channel is closed after `Exited` status is delivered, or when watching is stopped.
+func (h *Helper) WatchStatus() (<-chan ServerStatus, func()) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+
+	w := make(chan ServerStatus, Exited+1)
+	if h.status == Exited {
+		close(w)
+		return w, func() {}
+	}
+	h.watchers = append(h.watchers, w)
+
+	return w, func() {
+		h.statusLock.Lock()
+		defer h.statusLock.Unlock()
+		for i, ww := range h.watchers {
+			if ww == w {
+				h.watchers = append(h.watchers[:i], h.watchers[i+1:]...)
+				close(w)
+				return
+			}
+		}
+	}
+}
+
+func (h *Helper) addHook(status ServerStatus, hook func(ctx context.Context) error) {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	if h.hooks == nil {
+		h.hooks = make(map[ServerStatus][]func(ctx context.Context) error)
+	}
+	h.hooks[status] = append(h.hooks[status], hook)
+}
+
+// OnInitializing registers a hook called when `initialize` request is received, before it is passed to the server.
+// The hooks are called in the order of registration. The first error stops the chain, and is returned as the
+// `initialize` response. In that case, the status is restored, so `initialize` can be sent again.
+func (h *Helper) OnInitializing(hook func(ctx context.Context) error) {
+	h.addHook(Initializing, hook)
+}
+
+// OnInitialized registers a hook called when `initialized` notification is received, before it is passed to the
+// server. The hooks are called in the order of registration. The first error stops the chain, the notification isn't
+// passed to the server, and the status is restored.
+func (h *Helper) OnInitialized(hook func(ctx context.Context) error) {
+	h.addHook(Initialized, hook)
+}
+
+// OnShutdown registers a hook called when `shutdown` request is received, before it is passed to the server. The
+// hooks are called in the order of registration. The first error stops the chain, and is returned as the `shutdown`
+// response. In that case, the status is restored.
+func (h *Helper) OnShutdown(hook func(ctx context.Context) error) {
+	h.addHook(Shutdown, hook)
+}
+
+// OnExit registers a hook called when `exit` notification is received, before it is passed to the server. The hooks
+// are called in the order of registration, and their errors are only logged. Use `ExitCode` to check if the exit is
+// clean.
+func (h *Helper) OnExit(hook func(ctx context.Context) error) {
+	h.addHook(Exited, hook)
+}
+
+// ExitCode returns the code the process should exit with after `exit` notification: 0 if `shutdown` was received
+// before it, 1 otherwise.
+func (h *Helper) ExitCode() int {
+	h.statusLock.Lock()
+	defer h.statusLock.Unlock()
+	if h.cleanExit {
+		return 0
+	}
+	return 1
+}
+
+// transition changes the status, and calls the hooks registered for the new status.
+func (h *Helper) transition(ctx context.Context, status ServerStatus) error {
+	prev, err := h.setStatus(status)
+	if err != nil {
+		return err
+	}
+
+	h.statusLock.Lock()
+	hooks := h.hooks[status]
+	h.statusLock.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			if status != Exited {
+				// The message isn't passed to the server, so the status must stay as it was, e.g. to allow `initialize`
+				// to be retried.
+				h.restoreStatus(status, prev)
+				return fmt.Errorf("%s hook: %w", status, err)
+			}
+			h.logger.Error("exit hook", zap.Error(err))
+		}
+	}
+
+	h.statusLock.Lock()
+	if h.status == status {
+		h.notifyWatchersLocked()
+	}
+	h.statusLock.Unlock()
+
+	if status == Exited {
+		// The server may terminate the process on exit, so make sure the logs are written.
+		_ = h.logger.Sync()
+	}
+	return nil
 }
 
 // GetStatus returns the current ServerStatus.
@@ -0,0 +1,43 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTransitionHookFailure(t *testing.T) {
+	h := newTestHelper(t, Created)
+	statuses, stop := h.WatchStatus()
+	defer stop()
+
+	fail := errors.New("hook failed")
+	h.OnInitializing(func(context.Context) error {
+		err := fail
+		fail = nil
+		return err
+	})
+
+	if err := h.transition(context.Background(), Initializing); err == nil {
+		t.Fatal("transition succeeded, want hook error")
+	}
+	if s := h.GetStatus(); s != Created {
+		t.Fatalf("status = %s after failed hook, want %s", s, Created)
+	}
+	select {
+	case s := <-statuses:
+		t.Fatalf("watcher received %s after failed hook", s)
+	default:
+	}
+
+	// The retried transition must succeed.
+	if err := h.transition(context.Background(), Initializing); err != nil {
+		t.Fatal(err)
+	}
+	if s := h.GetStatus(); s != Initializing {
+		t.Fatalf("status = %s, want %s", s, Initializing)
+	}
+	if s := <-statuses; s != Initializing {
+		t.Fatalf("watcher received %s, want %s", s, Initializing)
+	}
+}
@@ -0,0 +1,77 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+// LifecyclePolicy determines how the messages received in a wrong lifecycle state are handled.
+type LifecyclePolicy int
+
+const (
+	// EnforceLifecycle rejects the requests received before `initialize` with `ErrServerNotInitialized`, and the ones
+	// received after `shutdown` (or `exit`) with `jsonrpc2.ErrInvalidRequest`. The notifications received in these states are
+	// dropped. `exit` is always passed through.
+	EnforceLifecycle LifecyclePolicy = iota
+	// LogLifecycle only logs the messages received in a wrong lifecycle state, and passes them through.
+	LogLifecycle
+	// IgnoreLifecycle passes all the messages through.
+	IgnoreLifecycle
+)
+
+func (p LifecyclePolicy) String() string {
+	switch p {
+	case EnforceLifecycle:
+		return "EnforceLifecycle"
+	case LogLifecycle:
+		return "LogLifecycle"
+	case IgnoreLifecycle:
+		return "IgnoreLifecycle"
+	default:
+		return fmt.Sprintf("Unknown lifecycle policy %d", p)
+	}
+}
+
+// lifecycleError returns the error for `req` if it isn't allowed in `status`, or `nil` if it is.
+func lifecycleError(status ServerStatus, req *Request) error {
+	switch {
+	case req.Method == MethodExit:
+		return nil
+	case req.Method == MethodInitialize && status != Created:
+		return fmt.Errorf("%w: %s already received", jsonrpc2.ErrInvalidRequest, req.Method)
+	case status == Created && req.Method != MethodInitialize:
+		return fmt.Errorf("%w: %s received before %s", ErrServerNotInitialized, req.Method, MethodInitialize)
+	case status == Shutdown || status == Exited:
+		return fmt.Errorf("%w: %s received after %s", jsonrpc2.ErrInvalidRequest, req.Method, MethodShutdown)
+	default:
+		return nil
+	}
+}
+
+// lifecycleMiddleware applies `policy` to the messages received in a wrong lifecycle state.
+func lifecycleMiddleware(h *Helper, policy LifecyclePolicy, lgr *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		if policy == IgnoreLifecycle {
+			return next
+		}
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			err := lifecycleError(h.GetStatus(), req)
+			switch {
+			case err == nil:
+				return next(ctx, req)
+			case policy == LogLifecycle:
+				lgr.Warn("lifecycle violation", zap.Error(err))
+				return next(ctx, req)
+			case req.Notification:
+				lgr.Debug("notification dropped", zap.Error(err))
+				return nil, nil
+			default:
+				lgr.Debug("request rejected", zap.Error(err))
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+// newTestHelper returns a helper in `status`.
+func newTestHelper(t *testing.T, status ServerStatus) *Helper {
+	t.Helper()
+	h := newHelper(nil, zap.NewNop())
+	for s := Initializing; s <= status; s++ {
+		if _, err := h.setStatus(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return h
+}
+
+func TestLifecycleMiddleware(t *testing.T) {
+	var (
+		hover   = &Request{Method: MethodHover}
+		open    = &Request{Method: MethodDidOpen, Notification: true}
+		initReq = &Request{Method: MethodInitialize}
+		exit    = &Request{Method: MethodExit, Notification: true}
+	)
+	tests := []struct {
+		name   string
+		policy LifecyclePolicy
+		status ServerStatus
+		req    *Request
+		want   error // `nil` if the request must be passed through
+		drop   bool  // the notification must be dropped
+	}{
+		{"enforce request before initialize", EnforceLifecycle, Created, hover, ErrServerNotInitialized, false},
+		{"enforce notification before initialize", EnforceLifecycle, Created, open, nil, true},
+		{"enforce initialize", EnforceLifecycle, Created, initReq, nil, false},
+		{"enforce exit before initialize", EnforceLifecycle, Created, exit, nil, false},
+		{"enforce request when initialized", EnforceLifecycle, Initialized, hover, nil, false},
+		{"enforce request after shutdown", EnforceLifecycle, Shutdown, hover, jsonrpc2.ErrInvalidRequest, false},
+		{"enforce notification after shutdown", EnforceLifecycle, Shutdown, open, nil, true},
+		{"enforce exit after shutdown", EnforceLifecycle, Shutdown, exit, nil, false},
+		{"log request before initialize", LogLifecycle, Created, hover, nil, false},
+		{"log notification before initialize", LogLifecycle, Created, open, nil, false},
+		{"log request after shutdown", LogLifecycle, Shutdown, hover, nil, false},
+		{"log exit after shutdown", LogLifecycle, Shutdown, exit, nil, false},
+		{"ignore request before initialize", IgnoreLifecycle, Created, hover, nil, false},
+		{"ignore notification before initialize", IgnoreLifecycle, Created, open, nil, false},
+		{"ignore request after shutdown", IgnoreLifecycle, Shutdown, hover, nil, false},
+		{"ignore exit after shutdown", IgnoreLifecycle, Shutdown, exit, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHelper(t, tt.status)
+			called := false
+			next := func(context.Context, *Request) (interface{}, error) {
+				called = true
+				return "ok", nil
+			}
+
+			res, err := lifecycleMiddleware(h, tt.policy, zap.NewNop())(next)(context.Background(), tt.req)
+
+			passed := tt.want == nil && !tt.drop
+			if called != passed {
+				t.Fatalf("passed through = %v, want %v", called, passed)
+			}
+			switch {
+			case tt.want != nil:
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+				if res != nil {
+					t.Fatalf("res = %v, want nil", res)
+				}
+			case err != nil:
+				t.Fatalf("err = %v, want nil", err)
+			case tt.drop && res != nil:
+				t.Fatalf("res = %v, want nil", res)
+			case passed && res != "ok":
+				t.Fatalf("res = %v, want ok", res)
+			}
+		})
+	}
+}
+
+func TestServerNotInitializedCode(t *testing.T) {
+	data, err := json.Marshal(ErrServerNotInitialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"code":-32002`) {
+		t.Fatalf("ErrServerNotInitialized = %s, want code -32002", data)
+	}
+}
@@ -0,0 +1,231 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ClientLogOptions configures forwarding of the log entries to the client through `window/logMessage` notifications.
+// See `Config.ClientLog`.
+type ClientLogOptions struct {
+	// Level is the minimum level of the forwarded entries. The default is Info.
+	Level zapcore.Level `json:"level"`
+	// RateLimit is the maximum number of entries forwarded per second. The entries above the limit are dropped. The
+	// default is 20.
+	RateLimit int `json:"rateLimit"`
+	// BufferSize is the maximum number of entries waiting to be forwarded, including the ones logged before the client
+	// sent `initialize` request. The entries above the limit are dropped. The default is 256.
+	BufferSize int `json:"bufferSize"`
+}
+
+const (
+	defaultClientLogRateLimit  = 20
+	defaultClientLogBufferSize = 256
+)
+
+// clientLogContextKey marks the context of the `window/logMessage` notifications sent by the sink, so that they aren't
+// logged, and forwarded again.
+type clientLogContextKey struct{}
+
+// clientLogEntry is a log entry waiting to be forwarded.
+type clientLogEntry struct {
+	typ     protocol.MessageType
+	message string
+}
+
+// clientLogSink forwards the log entries to the client.
+type clientLogSink struct {
+	level   zapcore.Level
+	rate    float64
+	entries chan clientLogEntry
+
+	mu      sync.Mutex
+	tokens  float64   // the number of entries that can be forwarded now
+	last    time.Time // the last time `tokens` was refilled
+	dropped int       // the number of entries dropped since the last forwarded one
+}
+
+// newClientLogSink creates the sink configured by `cfg`, or returns `nil` if forwarding isn't enabled.
+func newClientLogSink(cfg *Config) *clientLogSink {
+	if cfg == nil || cfg.ClientLog == nil {
+		return nil
+	}
+	opts := *cfg.ClientLog
+	if opts.RateLimit <= 0 {
+		opts.RateLimit = defaultClientLogRateLimit
+	}
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultClientLogBufferSize
+	}
+	return &clientLogSink{
+		level:   opts.Level,
+		rate:    float64(opts.RateLimit),
+		entries: make(chan clientLogEntry, opts.BufferSize),
+		tokens:  float64(opts.RateLimit),
+		last:    time.Now(),
+	}
+}
+
+// wrap adds the sink to `core`. It's used with `zap.WrapCore`.
+func (s *clientLogSink) wrap(core zapcore.Core) zapcore.Core {
+	enc := zapcore.NewConsoleEncoder(zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		NameKey:        "logger",
+		StacktraceKey:  "stacktrace",
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+	})
+	return zapcore.NewTee(core, &clientLogCore{sink: s, enc: enc})
+}
+
+// start forwards the entries to `clnt` in the background, as soon as the client sent `initialize` request, until the
+// server exits or `ctx` is done.
+func (s *clientLogSink) start(ctx context.Context, h *Helper, clnt protocol.ClientCloser) {
+	if s == nil {
+		return
+	}
+	statuses, stop := h.WatchStatus()
+	go func() {
+		defer stop()
+
+		ctx := context.WithValue(ctx, clientLogContextKey{}, true)
+		status := h.GetStatus()
+		for status == Created {
+			select {
+			case st, ok := <-statuses:
+				if !ok {
+					return
+				}
+				status = st
+			case <-ctx.Done():
+				return
+			}
+		}
+		for {
+			select {
+			case e := <-s.entries:
+				s.send(ctx, clnt, e)
+			case st, ok := <-statuses:
+				if !ok || st == Exited {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// send forwards `e`, preceded by the number of the entries dropped, if any. The errors are ignored, since they can't
+// be logged without being forwarded again.
+func (s *clientLogSink) send(ctx context.Context, clnt protocol.ClientCloser, e clientLogEntry) {
+	s.mu.Lock()
+	dropped := s.dropped
+	s.dropped = 0
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		_ = clnt.LogMessage(ctx, &protocol.LogMessageParams{
+			Type:    protocol.Warning,
+			Message: fmt.Sprintf("%d log messages dropped", dropped),
+		})
+	}
+	_ = clnt.LogMessage(ctx, &protocol.LogMessageParams{Type: e.typ, Message: e.message})
+}
+
+// enqueue adds the entry to the ones waiting to be forwarded, unless the rate limit is reached or the buffer is full.
+func (s *clientLogSink) enqueue(e clientLogEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.rate {
+		s.tokens = s.rate
+	}
+	s.last = now
+	if s.tokens < 1 {
+		s.dropped++
+		return
+	}
+
+	select {
+	case s.entries <- e:
+		s.tokens--
+	default:
+		s.dropped++
+	}
+}
+
+// clientLogCore is the `zapcore.Core` that passes the entries to the sink.
+type clientLogCore struct {
+	sink *clientLogSink
+	enc  zapcore.Encoder
+}
+
+func (c *clientLogCore) Enabled(level zapcore.Level) bool {
+	return level >= c.sink.level
+}
+
+func (c *clientLogCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &clientLogCore{sink: c.sink, enc: enc}
+}
+
+func (c *clientLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *clientLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	c.sink.enqueue(clientLogEntry{typ: messageType(ent.Level), message: msg})
+	return nil
+}
+
+func (c *clientLogCore) Sync() error {
+	return nil
+}
+
+// messageType returns the `window/logMessage` type for the zap level.
+func messageType(level zapcore.Level) protocol.MessageType {
+	switch {
+	case level >= zapcore.ErrorLevel:
+		return protocol.Error
+	case level == zapcore.WarnLevel:
+		return protocol.Warning
+	case level == zapcore.InfoLevel:
+		return protocol.Info
+	default:
+		return protocol.Log
+	}
+}
+
+// Logger returns the logger of the session. If `Config.ClientLog` is set, its entries are also forwarded to the
+// client.
+func (h *Helper) Logger() *zap.Logger {
+	return h.sessionLogger
+}
+
+// isClientLog returns `true` if `ctx` is the context of a `window/logMessage` notification sent by the sink.
+func isClientLog(ctx context.Context) bool {
+	return ctx.Value(clientLogContextKey{}) != nil
+}
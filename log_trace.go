@@ -0,0 +1,100 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// TraceLevel returns the trace level set by the client: by `$/setTrace` notification, or by `trace` param of
+// `initialize` request.
+func (h *Helper) TraceLevel() protocol.TraceValues {
+	h.clientMu.RLock()
+	level := h.trace
+	h.clientMu.RUnlock()
+
+	if level != "" {
+		return level
+	}
+	return protocol.TraceValues(h.InitialTrace())
+}
+
+// setTraceLevel sets the trace level received by `$/setTrace` notification.
+func (h *Helper) setTraceLevel(level protocol.TraceValues) {
+	switch level {
+	case protocol.Off, protocol.Messages, protocol.Verbose:
+	default:
+		h.logger.Warn("unknown trace level", zap.String("level", string(level)))
+		return
+	}
+	h.clientMu.Lock()
+	defer h.clientMu.Unlock()
+	h.trace = level
+}
+
+// logTraceMiddleware sends `$/logTrace` notification to the client for every request and notification handled while
+// the server is initialized, if the trace level isn't "off". At "verbose" level, the notification also contains the
+// params and the result.
+func logTraceMiddleware(helper *Helper, lgr *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			start := time.Now()
+			res, err := next(ctx, req)
+
+			if helper == nil || helper.clnt == nil || helper.GetStatus() != Initialized {
+				return res, err
+			}
+			level := helper.TraceLevel()
+			if level != protocol.Messages && level != protocol.Verbose {
+				return res, err
+			}
+
+			params := &protocol.LogTraceParams{Message: traceMessage(req, time.Since(start), err)}
+			if level == protocol.Verbose {
+				params.Verbose = traceVerbose(req, res, err)
+			}
+			// The request may be cancelled already, but its trace should be sent anyway.
+			if terr := helper.clnt.LogTrace(withoutCancel(ctx), params); terr != nil {
+				lgr.Debug("logTrace", zap.String("method", req.Method), zap.Error(terr))
+			}
+			return res, err
+		}
+	}
+}
+
+// traceMessage returns the message of `$/logTrace` notification for `req`.
+func traceMessage(req *Request, d time.Duration, err error) string {
+	kind := "request"
+	if req.Notification {
+		kind = "notification"
+	}
+	if err != nil {
+		return fmt.Sprintf("Handling %s '%s' failed in %dms.", kind, req.Method, d.Milliseconds())
+	}
+	return fmt.Sprintf("Handled %s '%s' in %dms.", kind, req.Method, d.Milliseconds())
+}
+
+// traceVerbose returns the verbose part of `$/logTrace` notification for `req`: the params, and the result or the
+// error.
+func traceVerbose(req *Request, res interface{}, err error) string {
+	s := "Params: " + traceJSON(req.Params)
+	switch {
+	case err != nil:
+		s += "\n\nError: " + err.Error()
+	case !req.Notification:
+		s += "\n\nResult: " + traceJSON(res)
+	}
+	return s
+}
+
+func traceJSON(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(data)
+}
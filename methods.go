@@ -0,0 +1,103 @@
+package lsp_srv_ex
+
+// LSP method names, as passed to middlewares in `Request.Method`.
+const (
+	// Sent in both directions.
+
+	MethodProgress = "$/progress"
+
+	// Sent by the client.
+
+	MethodSetTrace                  = "$/setTrace"
+	MethodCancelRequest             = "$/cancelRequest"
+	MethodIncomingCalls             = "callHierarchy/incomingCalls"
+	MethodOutgoingCalls             = "callHierarchy/outgoingCalls"
+	MethodResolveCodeAction         = "codeAction/resolve"
+	MethodResolveCodeLens           = "codeLens/resolve"
+	MethodResolveCompletionItem     = "completionItem/resolve"
+	MethodResolveDocumentLink       = "documentLink/resolve"
+	MethodExit                      = "exit"
+	MethodInitialize                = "initialize"
+	MethodInitialized               = "initialized"
+	MethodResolveInlayHint          = "inlayHint/resolve"
+	MethodDidChangeNotebookDocument = "notebookDocument/didChange"
+	MethodDidCloseNotebookDocument  = "notebookDocument/didClose"
+	MethodDidOpenNotebookDocument   = "notebookDocument/didOpen"
+	MethodDidSaveNotebookDocument   = "notebookDocument/didSave"
+	MethodShutdown                  = "shutdown"
+	MethodCodeAction                = "textDocument/codeAction"
+	MethodCodeLens                  = "textDocument/codeLens"
+	MethodColorPresentation         = "textDocument/colorPresentation"
+	MethodCompletion                = "textDocument/completion"
+	MethodDeclaration               = "textDocument/declaration"
+	MethodDefinition                = "textDocument/definition"
+	MethodDiagnostic                = "textDocument/diagnostic"
+	MethodDidChange                 = "textDocument/didChange"
+	MethodDidClose                  = "textDocument/didClose"
+	MethodDidOpen                   = "textDocument/didOpen"
+	MethodDidSave                   = "textDocument/didSave"
+	MethodDocumentColor             = "textDocument/documentColor"
+	MethodDocumentHighlight         = "textDocument/documentHighlight"
+	MethodDocumentLink              = "textDocument/documentLink"
+	MethodDocumentSymbol            = "textDocument/documentSymbol"
+	MethodFoldingRange              = "textDocument/foldingRange"
+	MethodFormatting                = "textDocument/formatting"
+	MethodHover                     = "textDocument/hover"
+	MethodImplementation            = "textDocument/implementation"
+	MethodInlayHint                 = "textDocument/inlayHint"
+	MethodInlineValue               = "textDocument/inlineValue"
+	MethodLinkedEditingRange        = "textDocument/linkedEditingRange"
+	MethodMoniker                   = "textDocument/moniker"
+	MethodOnTypeFormatting          = "textDocument/onTypeFormatting"
+	MethodPrepareCallHierarchy      = "textDocument/prepareCallHierarchy"
+	MethodPrepareRename             = "textDocument/prepareRename"
+	MethodPrepareTypeHierarchy      = "textDocument/prepareTypeHierarchy"
+	MethodRangeFormatting           = "textDocument/rangeFormatting"
+	MethodReferences                = "textDocument/references"
+	MethodRename                    = "textDocument/rename"
+	MethodSelectionRange            = "textDocument/selectionRange"
+	MethodSemanticTokensFull        = "textDocument/semanticTokens/full"
+	MethodSemanticTokensFullDelta   = "textDocument/semanticTokens/full/delta"
+	MethodSemanticTokensRange       = "textDocument/semanticTokens/range"
+	MethodSignatureHelp             = "textDocument/signatureHelp"
+	MethodTypeDefinition            = "textDocument/typeDefinition"
+	MethodWillSave                  = "textDocument/willSave"
+	MethodWillSaveWaitUntil         = "textDocument/willSaveWaitUntil"
+	MethodSubtypes                  = "typeHierarchy/subtypes"
+	MethodSupertypes                = "typeHierarchy/supertypes"
+	MethodWorkDoneProgressCancel    = "window/workDoneProgress/cancel"
+	MethodDiagnosticWorkspace       = "workspace/diagnostic"
+	MethodDidChangeConfiguration    = "workspace/didChangeConfiguration"
+	MethodDidChangeWatchedFiles     = "workspace/didChangeWatchedFiles"
+	MethodDidChangeWorkspaceFolders = "workspace/didChangeWorkspaceFolders"
+	MethodDidCreateFiles            = "workspace/didCreateFiles"
+	MethodDidDeleteFiles            = "workspace/didDeleteFiles"
+	MethodDidRenameFiles            = "workspace/didRenameFiles"
+	MethodExecuteCommand            = "workspace/executeCommand"
+	MethodSymbol                    = "workspace/symbol"
+	MethodWillCreateFiles           = "workspace/willCreateFiles"
+	MethodWillDeleteFiles           = "workspace/willDeleteFiles"
+	MethodWillRenameFiles           = "workspace/willRenameFiles"
+	MethodResolveWorkspaceSymbol    = "workspaceSymbol/resolve"
+
+	// Sent by the server.
+
+	MethodLogTrace               = "$/logTrace"
+	MethodRegisterCapability     = "client/registerCapability"
+	MethodUnregisterCapability   = "client/unregisterCapability"
+	MethodEvent                  = "telemetry/event"
+	MethodPublishDiagnostics     = "textDocument/publishDiagnostics"
+	MethodLogMessage             = "window/logMessage"
+	MethodShowDocument           = "window/showDocument"
+	MethodShowMessage            = "window/showMessage"
+	MethodShowMessageRequest     = "window/showMessageRequest"
+	MethodWorkDoneProgressCreate = "window/workDoneProgress/create"
+	MethodApplyEdit              = "workspace/applyEdit"
+	MethodCodeLensRefresh        = "workspace/codeLens/refresh"
+	MethodConfiguration          = "workspace/configuration"
+	MethodDiagnosticRefresh      = "workspace/diagnostic/refresh"
+	MethodInlayHintRefresh       = "workspace/inlayHint/refresh"
+	MethodInlineValueRefresh     = "workspace/inlineValue/refresh"
+	MethodSemanticTokensRefresh  = "workspace/semanticTokens/refresh"
+	MethodWorkspaceFolders       = "workspace/workspaceFolders"
+)
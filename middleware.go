@@ -0,0 +1,134 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+// Request represents an LSP request or notification passed through a middleware chain.
+type Request struct {
+	// Method is the LSP method name, like `MethodHover`.
+	Method string
+	// Params are the parameters, of the type used by the corresponding `protocol.Server` or `protocol.Client` method
+	// (e.g. `*protocol.HoverParams`), or `nil` for the methods without parameters. A middleware may replace them with
+	// a value of the same type.
+	Params interface{}
+	// Notification is `true` for notifications, which have no result.
+	Notification bool
+
+	call func(ctx context.Context, params interface{}) (interface{}, error)
+}
+
+// Handler handles a `Request`. The result must be of the type returned by the corresponding `protocol.Server` or
+// `protocol.Client` method, or `nil`.
+type Handler func(ctx context.Context, req *Request) (interface{}, error)
+
+// Middleware wraps the next `Handler` in the chain. It can inspect or modify the request before calling `next`, the
+// result after calling it, or short-circuit the chain by not calling `next` at all.
+type Middleware func(next Handler) Handler
+
+// newChain composes the middlewares around the handler that executes the request, so that the first middleware is the
+// outermost one.
+func newChain(mws ...Middleware) Handler {
+	h := Handler(func(ctx context.Context, req *Request) (interface{}, error) {
+		return req.call(ctx, req.Params)
+	})
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			h = mws[i](h)
+		}
+	}
+	return h
+}
+
+// loggingMiddleware logs every request passed through the chain.
+func loggingMiddleware(lgr *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			// The log entries forwarded to the client must not be forwarded again.
+			if !isClientLog(ctx) {
+				lgr.Debug(req.Method, zap.Any("params", req.Params))
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// call passes a request through the chain `h`, and `fn` is called at the end of the chain.
+func call[P any, R any](ctx context.Context, h Handler, method string, params P,
+	fn func(context.Context, P) (R, error)) (R, error) {
+	req := &Request{Method: method, Params: params}
+	req.call = func(ctx context.Context, params interface{}) (interface{}, error) {
+		p, err := paramsAs[P](method, params)
+		if err != nil {
+			return nil, err
+		}
+		return fn(ctx, p)
+	}
+	res, err := h(ctx, req)
+	return resultAs[R](method, res, err)
+}
+
+// callNoResult passes a request without result through the chain `h`, and `fn` is called at the end of the chain.
+func callNoResult[P any](ctx context.Context, h Handler, method string, params P,
+	fn func(context.Context, P) error) error {
+	_, err := call(ctx, h, method, params, func(ctx context.Context, p P) (interface{}, error) {
+		return nil, fn(ctx, p)
+	})
+	return err
+}
+
+// notify passes a notification through the chain `h`, and `fn` is called at the end of the chain.
+func notify[P any](ctx context.Context, h Handler, method string, params P,
+	fn func(context.Context, P) error) error {
+	req := &Request{Method: method, Params: params, Notification: true}
+	req.call = func(ctx context.Context, params interface{}) (interface{}, error) {
+		p, err := paramsAs[P](method, params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fn(ctx, p)
+	}
+	_, err := h(ctx, req)
+	return err
+}
+
+func paramsAs[P any](method string, params interface{}) (P, error) {
+	var p P
+	if params == nil {
+		return p, nil
+	}
+	p, ok := params.(P)
+	if !ok {
+		return p, fmt.Errorf("%w: %s unexpected params type %T", jsonrpc2.ErrInternal, method, params)
+	}
+	return p, nil
+}
+
+func resultAs[R any](method string, res interface{}, err error) (R, error) {
+	var r R
+	if res == nil {
+		return r, err
+	}
+	r, ok := res.(R)
+	if !ok && err == nil {
+		err = fmt.Errorf("%w: %s unexpected result type %T", jsonrpc2.ErrInternal, method, res)
+	}
+	return r, err
+}
+
+type asyncContextKey struct{}
+
+// handleAsync lets the messages received after the request be handled while it's still in progress (see
+// `jsonrpc2.Async`), instead of waiting for its response. It returns the context to pass on, since the request can be
+// released only once.
+func handleAsync(ctx context.Context) context.Context {
+	if ctx.Value(asyncContextKey{}) != nil {
+		return ctx
+	}
+	jsonrpc2.Async(ctx)
+	return context.WithValue(ctx, asyncContextKey{}, true)
+}
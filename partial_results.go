@@ -0,0 +1,82 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"sync"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// PartialResults streams the results of a request returning a list, like `textDocument/references`, in batches
+// through `$/progress` notifications on the partial result token supplied by the client. If the client didn't supply
+// the token, the results are collected and returned at once by `Result`.
+type PartialResults[T any] struct {
+	helper *Helper
+	ctx    context.Context
+	token  protocol.ProgressToken
+	wrap   func(items []T) interface{}
+
+	mu    sync.Mutex
+	items []T // collected if there's no token
+}
+
+// NewPartialResults creates a `PartialResults` for a request with `token` (`PartialResultToken` from the params),
+// which may be `nil`.
+func NewPartialResults[T any](ctx context.Context, h *Helper, token protocol.ProgressToken) *PartialResults[T] {
+	return &PartialResults[T]{
+		helper: h,
+		ctx:    ctx,
+		token:  token,
+	}
+}
+
+// WithWrapper sets the function that converts a batch to the value of `$/progress` notification, for the requests
+// whose partial result isn't a plain list, like `workspace/diagnostic` (`protocol.WorkspaceDiagnosticReportPartialResult`).
+func (p *PartialResults[T]) WithWrapper(wrap func(items []T) interface{}) *PartialResults[T] {
+	p.wrap = wrap
+	return p
+}
+
+// Streaming returns `true` if the results are sent to the client in batches.
+func (p *PartialResults[T]) Streaming() bool {
+	return p.token != nil && p.helper.clnt != nil
+}
+
+// Send sends a batch of results to the client, or collects it if the results aren't streamed. Safe for concurrent
+// use.
+func (p *PartialResults[T]) Send(items ...T) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.Streaming() {
+		p.items = append(p.items, items...)
+		return nil
+	}
+
+	var value interface{} = items
+	if p.wrap != nil {
+		value = p.wrap(items)
+	}
+	err := p.helper.clnt.Progress(p.ctx, &protocol.ProgressParams{Token: p.token, Value: value})
+	if err != nil {
+		p.helper.logger.Warn("partial result", zap.Error(err))
+	}
+	return err
+}
+
+// Result returns the final result of the request: an empty list if the results are streamed, as required by the
+// specification, or all the collected results otherwise.
+func (p *PartialResults[T]) Result() []T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Streaming() || p.items == nil {
+		return []T{}
+	}
+	return p.items
+}
@@ -0,0 +1,228 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// defaultProgressInterval is the minimal interval between two progress reports, if not set in `ProgressOptions`.
+const defaultProgressInterval = 100 * time.Millisecond
+
+// ProgressOptions configures a progress started by `Helper.StartProgress`.
+type ProgressOptions struct {
+	// Token is the work done token supplied by the client in the request params (`WorkDoneToken`). If `nil`, a new
+	// token is created by `window/workDoneProgress/create` request, if the client supports it.
+	Token protocol.ProgressToken
+	// Cancellable shows the cancel button in the client. The cancellation cancels `ProgressReporter.Context`.
+	Cancellable bool
+	// Message is the initial message.
+	Message string
+	// Total is the total amount of work, used by `ProgressReporter.Step` to compute the percentage. If zero, the
+	// percentage isn't reported by `Step`.
+	Total int
+	// Interval is the minimal interval between two reports: the more frequent reports are dropped. If zero,
+	// 100 milliseconds are used.
+	Interval time.Duration
+}
+
+// ProgressReporter reports the work done progress to the client. All its methods are safe to call on a `nil`
+// reporter, and do nothing if the client doesn't support the progress.
+type ProgressReporter struct {
+	helper   *Helper
+	token    protocol.ProgressToken // nil if the progress isn't reported
+	ctx      context.Context
+	cancel   context.CancelFunc
+	total    int
+	interval time.Duration
+
+	mu         sync.Mutex
+	done       int
+	percentage uint32
+	lastReport time.Time
+	ended      bool
+}
+
+// StartProgress starts reporting the progress of the work titled `title`, and sends `begin` notification. `opts` may
+// be `nil`. `ProgressReporter.End` must be called when the work is done.
+func (h *Helper) StartProgress(ctx context.Context, title string, opts *ProgressOptions) *ProgressReporter {
+	if opts == nil {
+		opts = &ProgressOptions{}
+	}
+	r := &ProgressReporter{
+		helper:   h,
+		token:    opts.Token,
+		total:    opts.Total,
+		interval: opts.Interval,
+	}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	if r.interval == 0 {
+		r.interval = defaultProgressInterval
+	}
+
+	if r.token == nil {
+		if !h.SupportsWorkDoneProgress() || h.clnt == nil {
+			return r
+		}
+		h.progressMu.Lock()
+		h.progressSeq++
+		token := fmt.Sprintf("lsp-srv-ex-progress-%d", h.progressSeq)
+		h.progressMu.Unlock()
+
+		err := h.clnt.WorkDoneProgressCreate(ctx, &protocol.WorkDoneProgressCreateParams{Token: token})
+		if err != nil {
+			h.logger.Warn("WorkDoneProgressCreate", zap.Error(err))
+			return r
+		}
+		r.token = token
+	}
+
+	h.progressMu.Lock()
+	if h.progress == nil {
+		h.progress = make(map[string]*ProgressReporter)
+	}
+	h.progress[fmt.Sprint(r.token)] = r
+	h.progressMu.Unlock()
+
+	begin := &protocol.WorkDoneProgressBegin{
+		Kind:        "begin",
+		Title:       title,
+		Cancellable: opts.Cancellable,
+		Message:     opts.Message,
+	}
+	r.send(begin)
+	r.lastReport = time.Now()
+
+	return r
+}
+
+// Context returns the context of the progress, cancelled when the client cancels the progress, or when it is ended.
+func (r *ProgressReporter) Context() context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// Report sends `report` notification with `message` and `percentage` (0-100). The percentage is never decreased, and
+// the report is dropped if sent less than `ProgressOptions.Interval` after the previous one.
+func (r *ProgressReporter) Report(message string, percentage uint32) {
+	if r == nil || r.token == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reportLocked(message, percentage)
+}
+
+// Step adds `n` to the amount of the work done, and sends `report` notification with `message`, and the percentage
+// computed from `ProgressOptions.Total`.
+func (r *ProgressReporter) Step(n int, message string) {
+	if r == nil || r.token == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.done += n
+	var percentage uint32
+	if r.total > 0 {
+		percentage = uint32(r.done * 100 / r.total)
+	}
+	r.reportLocked(message, percentage)
+}
+
+func (r *ProgressReporter) reportLocked(message string, percentage uint32) {
+	if r.ended {
+		return
+	}
+	if percentage > 100 {
+		percentage = 100
+	}
+	if percentage < r.percentage {
+		percentage = r.percentage
+	}
+	now := time.Now()
+	if now.Sub(r.lastReport) < r.interval {
+		return
+	}
+	r.percentage = percentage
+	r.lastReport = now
+
+	r.send(&protocol.WorkDoneProgressReport{
+		Kind:       "report",
+		Message:    message,
+		Percentage: percentage,
+	})
+}
+
+// End sends `end` notification with `message`, and cancels the context of the progress. The subsequent calls do
+// nothing.
+func (r *ProgressReporter) End(message string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ended {
+		return
+	}
+	r.ended = true
+	r.cancel()
+
+	if r.token == nil {
+		return
+	}
+	r.helper.progressMu.Lock()
+	delete(r.helper.progress, fmt.Sprint(r.token))
+	r.helper.progressMu.Unlock()
+
+	r.send(&protocol.WorkDoneProgressEnd{Kind: "end", Message: message})
+}
+
+// EndWithError ends the progress like `End`, with the error message if `err` isn't `nil`.
+func (r *ProgressReporter) EndWithError(err error) {
+	if err != nil {
+		r.End(err.Error())
+	} else {
+		r.End("")
+	}
+}
+
+func (r *ProgressReporter) send(value interface{}) {
+	// The progress must be reported even if its context is cancelled.
+	err := r.helper.clnt.Progress(withoutCancel(r.ctx), &protocol.ProgressParams{Token: r.token, Value: value})
+	if err != nil {
+		r.helper.logger.Warn("Progress", zap.Error(err))
+	}
+}
+
+// cancelProgress cancels the context of the progress with `token`, on `window/workDoneProgress/cancel` notification.
+func (h *Helper) cancelProgress(token protocol.ProgressToken) {
+	h.progressMu.Lock()
+	r := h.progress[fmt.Sprint(token)]
+	h.progressMu.Unlock()
+
+	if r != nil {
+		r.cancel()
+	}
+}
+
+// detachedContext keeps the values of the parent context, but is never cancelled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// withoutCancel returns a context with the values of `ctx`, which is never cancelled.
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
@@ -0,0 +1,43 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/peske/x-tools-internal/jsonrpc2"
+	"go.uber.org/zap"
+)
+
+// recoveryMiddleware recovers the panics of the rest of the chain, which are logged with the stack trace and returned
+// as `jsonrpc2.ErrInternal`, and maps the returned errors by `mapper`.
+func recoveryMiddleware(mapper ErrorMapper, lgr *zap.Logger) Middleware {
+	if mapper == nil {
+		mapper = DefaultErrorMapper
+	}
+	return func(next Handler) Handler {
+		next = panicRecoveryMiddleware(lgr)(next)
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			res, err := next(ctx, req)
+			if err != nil {
+				err = mapper(err)
+			}
+			return res, err
+		}
+	}
+}
+
+// panicRecoveryMiddleware recovers the panics of the rest of the chain, which are logged with the stack trace and
+// returned as `jsonrpc2.ErrInternal`. Unlike `recoveryMiddleware`, it returns the other errors as they are.
+func panicRecoveryMiddleware(lgr *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (res interface{}, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					lgr.Error("panic", zap.String("method", req.Method), zap.Any("panic", r), zap.Stack("stack"))
+					res, err = nil, fmt.Errorf("%w: %s: panic: %v", jsonrpc2.ErrInternal, req.Method, r)
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
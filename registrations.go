@@ -0,0 +1,265 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// ErrDynamicRegistrationNotSupported is returned by `Helper.Register` if the client doesn't support dynamic
+// registration of the capability.
+var ErrDynamicRegistrationNotSupported = errors.New("dynamic registration not supported by the client")
+
+// DynamicCapability describes a capability registered by `Helper.Register`.
+type DynamicCapability struct {
+	// Method is the method the capability is registered for, like `MethodDidChangeWatchedFiles`.
+	Method string
+	// Options returns the registration options, like `*protocol.DidChangeWatchedFilesRegistrationOptions`. It is
+	// called on every (re-)registration, so the options may depend on the configuration. Optional.
+	Options func() interface{}
+	// Enabled reports if the capability should be registered. It is called on every (re-)registration, so the
+	// capability may be enabled or disabled by the configuration. Optional: if `nil`, the capability is always
+	// registered.
+	Enabled func() bool
+	// Static sets the equivalent static capability, used if the client doesn't support dynamic registration for
+	// `Method`. Optional, and used only if `Helper.Register` is called before `initialize` request.
+	Static func(caps *protocol.ServerCapabilities)
+}
+
+// Registration is a capability added by `Helper.Register`.
+type Registration struct {
+	helper     *Helper
+	capability DynamicCapability
+	static     bool        // the static capability is used instead
+	id         string      // ID of the current registration, empty if not registered
+	options    interface{} // options of the current registration
+	pending    bool        // the registration is sent to the client, and waits for the response
+}
+
+// ID returns the ID of the current registration, or an empty string if the capability isn't registered.
+func (r *Registration) ID() string {
+	r.helper.regMu.Lock()
+	defer r.helper.regMu.Unlock()
+	return r.id
+}
+
+// Registered returns `true` if the capability is registered with the client.
+func (r *Registration) Registered() bool {
+	return r.ID() != ""
+}
+
+// Static returns `true` if the static capability is used instead of the dynamic registration.
+func (r *Registration) Static() bool {
+	r.helper.regMu.Lock()
+	defer r.helper.regMu.Unlock()
+	return r.static
+}
+
+// Register adds a capability to be registered with the client. If called before `initialize` request, the
+// capability is registered after `initialized` notification is received, or its static capability is used if the
+// client doesn't support dynamic registration for it. If called while `initialize` request is handled, the static
+// capability isn't used. If called after `initialized` notification, the capability is
+// registered immediately, and `ErrDynamicRegistrationNotSupported` is returned if the client doesn't support it.
+//
+// The registered capabilities are re-registered on `workspace/didChangeConfiguration` notification if their options
+// have changed, and unregistered on `shutdown` request.
+func (h *Helper) Register(ctx context.Context, capability DynamicCapability) (*Registration, error) {
+	r := &Registration{helper: h, capability: capability}
+
+	switch status := h.GetStatus(); status {
+	case Created, Initializing:
+		h.regMu.Lock()
+		h.registrations = append(h.registrations, r)
+		h.regMu.Unlock()
+		return r, nil
+	case Initialized:
+		if !h.SupportsDynamicRegistration(capability.Method) {
+			return nil, fmt.Errorf("%w: %s", ErrDynamicRegistrationNotSupported, capability.Method)
+		}
+		h.regMu.Lock()
+		h.registrations = append(h.registrations, r)
+		h.regMu.Unlock()
+		return r, h.syncRegistrations(ctx, []*Registration{r})
+	default:
+		return nil, fmt.Errorf("can't register %s in '%s' status", capability.Method, status)
+	}
+}
+
+// Unregister removes a capability added by `Register`, and unregisters it with the client if registered.
+func (h *Helper) Unregister(ctx context.Context, r *Registration) error {
+	h.regMu.Lock()
+	for i, rr := range h.registrations {
+		if rr == r {
+			h.registrations = append(h.registrations[:i:i], h.registrations[i+1:]...)
+			break
+		}
+	}
+	h.regMu.Unlock()
+	return h.unregister(ctx, []*Registration{r})
+}
+
+// RefreshRegistrations re-registers the capabilities whose options have changed, and registers or unregisters the
+// ones enabled or disabled since the last registration. It is called automatically on
+// `workspace/didChangeConfiguration` notification.
+func (h *Helper) RefreshRegistrations(ctx context.Context) error {
+	if h.GetStatus() != Initialized {
+		return nil
+	}
+	return h.syncRegistrations(ctx, h.allRegistrations())
+}
+
+// allRegistrations returns a copy of the registrations.
+func (h *Helper) allRegistrations() []*Registration {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+	return append([]*Registration(nil), h.registrations...)
+}
+
+// isRegistrationLocked returns `true` if `r` hasn't been removed by `Unregister`.
+func (h *Helper) isRegistrationLocked(r *Registration) bool {
+	for _, rr := range h.registrations {
+		if rr == r {
+			return true
+		}
+	}
+	return false
+}
+
+// staticCapabilities returns the static capabilities of the registrations not supported by the client dynamically.
+func (h *Helper) staticCapabilities() *protocol.ServerCapabilities {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+
+	caps := &protocol.ServerCapabilities{}
+	for _, r := range h.registrations {
+		if !h.SupportsDynamicRegistration(r.capability.Method) {
+			r.static = true
+			if r.capability.Static != nil {
+				r.capability.Static(caps)
+			}
+		}
+	}
+	return caps
+}
+
+// syncRegistrations brings the registrations with the client in line with the current state of `regs`. The lock
+// isn't held while waiting for the client, since the server may keep handling the messages meanwhile. The
+// registrations in progress are skipped.
+func (h *Helper) syncRegistrations(ctx context.Context, regs []*Registration) error {
+	var (
+		stale []*Registration
+		added []*Registration
+		rp    protocol.RegistrationParams
+	)
+
+	h.regMu.Lock()
+	for _, r := range regs {
+		if r.static || r.pending || !h.SupportsDynamicRegistration(r.capability.Method) {
+			continue
+		}
+		enabled := r.capability.Enabled == nil || r.capability.Enabled()
+		var opts interface{}
+		if enabled && r.capability.Options != nil {
+			opts = r.capability.Options()
+		}
+		if r.id != "" && enabled && reflect.DeepEqual(opts, r.options) {
+			continue
+		}
+		if r.id != "" {
+			stale = append(stale, r)
+		}
+		if enabled {
+			h.regSeq++
+			r.pending = true
+			added = append(added, r)
+			rp.Registrations = append(rp.Registrations, protocol.Registration{
+				ID:              fmt.Sprintf("%s#%d", r.capability.Method, h.regSeq),
+				Method:          r.capability.Method,
+				RegisterOptions: opts,
+			})
+		}
+	}
+	up := unregistrationsLocked(stale)
+	h.regMu.Unlock()
+
+	if err := h.sendUnregistrations(ctx, up); err != nil {
+		h.endPending(added)
+		return err
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if err := h.clnt.RegisterCapability(ctx, &rp); err != nil {
+		h.logger.Error("RegisterCapability", zap.Error(err))
+		h.endPending(added)
+		return err
+	}
+
+	// The capabilities removed by `Unregister` meanwhile must be unregistered again.
+	var removed []*Registration
+	h.regMu.Lock()
+	for i, r := range added {
+		r.id = rp.Registrations[i].ID
+		r.options = rp.Registrations[i].RegisterOptions
+		r.pending = false
+		if !h.isRegistrationLocked(r) {
+			removed = append(removed, r)
+		}
+	}
+	h.regMu.Unlock()
+	return h.unregister(ctx, removed)
+}
+
+// endPending marks the registrations of `regs` as no longer in progress, after they have failed.
+func (h *Helper) endPending(regs []*Registration) {
+	h.regMu.Lock()
+	defer h.regMu.Unlock()
+	for _, r := range regs {
+		r.pending = false
+	}
+}
+
+// unregister unregisters `regs` with the client.
+func (h *Helper) unregister(ctx context.Context, regs []*Registration) error {
+	h.regMu.Lock()
+	up := unregistrationsLocked(regs)
+	h.regMu.Unlock()
+	return h.sendUnregistrations(ctx, up)
+}
+
+// unregistrationsLocked returns the params unregistering `regs`. The client may fail to unregister, but the
+// registrations are considered gone anyway.
+func unregistrationsLocked(regs []*Registration) *protocol.UnregistrationParams {
+	var up protocol.UnregistrationParams
+	for _, r := range regs {
+		if r.id != "" {
+			up.Unregisterations = append(up.Unregisterations, protocol.Unregistration{
+				ID:     r.id,
+				Method: r.capability.Method,
+			})
+			r.id, r.options = "", nil
+		}
+	}
+	return &up
+}
+
+// sendUnregistrations sends `up` to the client, unless it's empty.
+func (h *Helper) sendUnregistrations(ctx context.Context, up *protocol.UnregistrationParams) error {
+	if len(up.Unregisterations) == 0 {
+		return nil
+	}
+	if err := h.clnt.UnregisterCapability(ctx, up); err != nil {
+		h.logger.Error("UnregisterCapability", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// unregisterAll unregisters all the capabilities registered with the client.
+func (h *Helper) unregisterAll(ctx context.Context) error {
+	return h.unregister(ctx, h.allRegistrations())
+}
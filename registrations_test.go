@@ -0,0 +1,83 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+)
+
+// registrationClient records the registrations, and calls `during` while waiting for the response.
+type registrationClient struct {
+	protocol.ClientCloser
+	h            *Helper
+	during       func()
+	locked       bool
+	unregistered []string
+}
+
+func (c *registrationClient) RegisterCapability(context.Context, *protocol.RegistrationParams) error {
+	if c.h.regMu.TryLock() {
+		c.h.regMu.Unlock()
+	} else {
+		c.locked = true
+	}
+	if c.during != nil {
+		c.during()
+	}
+	return nil
+}
+
+func (c *registrationClient) UnregisterCapability(_ context.Context, params *protocol.UnregistrationParams) error {
+	for _, u := range params.Unregisterations {
+		c.unregistered = append(c.unregistered, u.ID)
+	}
+	return nil
+}
+
+func newRegistrationHelper(t *testing.T) (*Helper, *registrationClient) {
+	h := newTestHelper(t, Initialized)
+	h.client = &clientInfo{raw: map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"workspace": map[string]interface{}{
+				"executeCommand": map[string]interface{}{"dynamicRegistration": true},
+			},
+		},
+	}}
+	c := &registrationClient{h: h}
+	h.clnt = c
+	return h, c
+}
+
+func TestRegisterUnlocked(t *testing.T) {
+	h, c := newRegistrationHelper(t)
+	r, err := h.Register(context.Background(), DynamicCapability{Method: MethodExecuteCommand})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.locked {
+		t.Fatal("the lock is held while waiting for the client")
+	}
+	if !r.Registered() {
+		t.Fatal("not registered")
+	}
+}
+
+func TestUnregisterWhileRegistering(t *testing.T) {
+	h, c := newRegistrationHelper(t)
+	c.during = func() {
+		if err := h.Unregister(context.Background(), h.allRegistrations()[0]); err != nil {
+			t.Error(err)
+		}
+	}
+	r, err := h.Register(context.Background(), DynamicCapability{Method: MethodExecuteCommand})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Registered() {
+		t.Fatal("registered after Unregister")
+	}
+	if len(c.unregistered) != 1 {
+		t.Fatalf("unregistered %v, want the registration sent before Unregister", c.unregistered)
+	}
+}
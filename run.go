@@ -2,6 +2,9 @@ package lsp_srv_ex
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/peske/lsp-srv/lsp/protocol"
 	"github.com/peske/lsp-srv/server"
@@ -10,12 +13,38 @@ import (
 
 var logger *zap.Logger
 
+// ExitError is returned by `Run` in stdio mode when the client sent `exit` notification without sending `shutdown`
+// request first.
+type ExitError struct {
+	// Code is the process exit code required by the specification.
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit without shutdown, exit code %d", e.Code)
+}
+
+// ExitCode returns the process exit code for the error returned by `Run`: 0 if `err` is `nil`, `ExitError.Code` if
+// `err` is an `*ExitError`, and 1 otherwise.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		return ee.Code
+	}
+	return 1
+}
+
 // Run function starts the server.
 // Params:
 // serverFactory: server factory
 // cfg:           Config instance.
 // zapLogger:     zap.Logger to use, or nil.
 // zapConfig:     Logging configuration to use. It will be ignored if `zapLogger` argument is not nil.
+// In stdio mode (neither `Port` nor `Address` is set), the returned error is an `*ExitError` if the client sent `exit`
+// without `shutdown`, so the process exit code can be determined by `ExitCode` function.
 func Run(serverFactory func(protocol.ClientCloser, context.Context, func(), *Helper) protocol.Server, cfg *Config,
 	zapLogger *zap.Logger) (err error) {
 	if zapLogger == nil {
@@ -36,12 +65,55 @@ func Run(serverFactory func(protocol.ClientCloser, context.Context, func(), *Hel
 		logger = zapLogger
 	}
 
+	tr, err := newTracer(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer tr.close()
+
+	// In stdio mode there's a single session, whose exit code is the exit code of the process. Otherwise, the
+	// sessions are independent, and the exit of one client doesn't affect the others.
+	stdio := cfg.stdio()
+	var (
+		mu          sync.Mutex
+		uncleanExit bool
+	)
+
 	sf := func(clnt protocol.ClientCloser, ctx context.Context, ccl func()) protocol.Server {
-		h := newHelper(cfg, logger)
-		cw := NewClientWrapper(clnt, h, logger.With(zap.String("object", "clientWrapper")))
+		lgr, sink := logger, newClientLogSink(cfg)
+		if sink != nil {
+			lgr = lgr.WithOptions(zap.WrapCore(sink.wrap))
+		}
+		h := newHelper(cfg, lgr)
+		h.cancel = ccl
+		h.tracer = tr
+		h.OnExit(func(context.Context) error {
+			switch {
+			case h.ExitCode() == 0:
+			case stdio:
+				mu.Lock()
+				uncleanExit = true
+				mu.Unlock()
+			default:
+				h.logger.Warn("exit without shutdown")
+			}
+			return nil
+		})
+		cw := NewClientWrapper(clnt, h, lgr.With(zap.String("object", "clientWrapper")))
+		h.clnt = cw
+		sink.start(ctx, h, cw)
 		s := serverFactory(cw, ctx, ccl, h)
-		return NewServerWrapper(s, h, cfg, logger.With(zap.String("object", "serverWrapper")))
+		return NewServerWrapper(s, h, cfg, lgr.With(zap.String("object", "serverWrapper")))
 	}
 
-	return server.Run(sf, cfg.toBaseConfig())
+	if err = server.Run(sf, cfg.toBaseConfig()); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if uncleanExit {
+		return &ExitError{Code: 1}
+	}
+	return nil
 }
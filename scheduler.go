@@ -0,0 +1,182 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SchedulePolicy determines how the requests for a method are scheduled. See `Config.Scheduling`.
+type SchedulePolicy struct {
+	// Debounce delays the requests: if a newer request for the same method and document is received meanwhile, or the
+	// request is cancelled by the client, it fails with `ErrRequestCancelled` without being passed to the server.
+	Debounce time.Duration `json:"debounce"`
+	// Coalesce passes the identical requests in flight at the same time (the same method and params, for the same
+	// version of the document) to the server once, and sends the same result to all of them.
+	Coalesce bool `json:"coalesce"`
+}
+
+// scheduler applies the `SchedulePolicy` of the methods.
+type scheduler struct {
+	helper   *Helper
+	policies map[string]SchedulePolicy
+	logger   *zap.Logger
+
+	mu      sync.Mutex
+	calls   map[string]*sharedCall
+	pending map[string]chan struct{} // closed when the debounced request is superseded
+}
+
+// sharedCall is a call to the server shared by the coalesced requests.
+type sharedCall struct {
+	done    chan struct{}
+	res     interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// schedulerMiddleware applies `policies` to the requests.
+func schedulerMiddleware(helper *Helper, policies map[string]SchedulePolicy, lgr *zap.Logger) Middleware {
+	s := &scheduler{
+		helper:   helper,
+		policies: policies,
+		logger:   lgr,
+		calls:    make(map[string]*sharedCall),
+		pending:  make(map[string]chan struct{}),
+	}
+	return func(next Handler) Handler {
+		// The coalesced calls are made in their own goroutines, so they need their own recovery. The errors are mapped
+		// by the outer recovery, as for the other requests.
+		shared := panicRecoveryMiddleware(lgr)(next)
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			p, ok := s.policies[req.Method]
+			if !ok || req.Notification {
+				return next(ctx, req)
+			}
+			// The scheduled requests wait for each other, so they must not block the messages received after them.
+			ctx = handleAsync(ctx)
+
+			if p.Debounce > 0 {
+				if err := s.debounce(ctx, req, p.Debounce); err != nil {
+					return nil, err
+				}
+			}
+
+			if !p.Coalesce {
+				return next(ctx, req)
+			}
+			key, ok := s.key(req)
+			if !ok {
+				return next(ctx, req)
+			}
+			return s.coalesce(ctx, key, req, shared)
+		}
+	}
+}
+
+// debounce waits for `d`, and fails with `ErrRequestCancelled` if a newer request for the same method and document is
+// received, or `ctx` is done meanwhile.
+func (s *scheduler) debounce(ctx context.Context, req *Request, d time.Duration) error {
+	key := req.Method
+	if uri, ok := documentURI(req.Params); ok {
+		key += "\x00" + string(uri)
+	}
+
+	superseded := make(chan struct{})
+	s.mu.Lock()
+	if prev := s.pending[key]; prev != nil {
+		close(prev)
+	}
+	s.pending[key] = superseded
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.pending[key] == superseded {
+			delete(s.pending, key)
+		}
+		s.mu.Unlock()
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-superseded:
+		s.logger.Debug("debounced request superseded", zap.String("method", req.Method))
+		return fmt.Errorf("%w: %s: superseded by a newer request", ErrRequestCancelled, req.Method)
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %s: %v", ErrRequestCancelled, req.Method, ctx.Err())
+	}
+}
+
+// key returns the key identifying the identical requests. The progress tokens, which differ between the otherwise
+// identical requests, are ignored.
+func (s *scheduler) key(req *Request) (string, bool) {
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		return "", false
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(params, &m) == nil && m != nil {
+		delete(m, "workDoneToken")
+		delete(m, "partialResultToken")
+		if params, err = json.Marshal(m); err != nil {
+			return "", false
+		}
+	}
+	version := int32(-1)
+	if uri, ok := documentURI(req.Params); ok && s.helper.Cache != nil {
+		version = documentVersion(s.helper.Cache, uri)
+	}
+	return fmt.Sprintf("%s\x00%d\x00%s", req.Method, version, params), true
+}
+
+// coalesce joins the call for `key` in flight, or starts it. The call is cancelled when all the requests waiting for
+// it are cancelled.
+func (s *scheduler) coalesce(ctx context.Context, key string, req *Request, next Handler) (interface{}, error) {
+	s.mu.Lock()
+	c := s.calls[key]
+	if c == nil {
+		// The call must not be cancelled with the request that started it, since the others may wait for it.
+		callCtx, cancel := context.WithCancel(withoutCancel(ctx))
+		c = &sharedCall{done: make(chan struct{}), cancel: cancel}
+		s.calls[key] = c
+		go func() {
+			c.res, c.err = next(callCtx, req)
+			s.mu.Lock()
+			if s.calls[key] == c {
+				delete(s.calls, key)
+			}
+			s.mu.Unlock()
+			cancel()
+			close(c.done)
+		}()
+	} else {
+		s.logger.Debug("coalesced request", zap.String("method", req.Method))
+	}
+	c.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.res, c.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// The new identical requests must not join the cancelled call.
+			if s.calls[key] == c {
+				delete(s.calls, key)
+			}
+			c.cancel()
+		}
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s: %v", ErrRequestCancelled, req.Method, ctx.Err())
+	}
+}
@@ -0,0 +1,80 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+func highlightRequest(token string) *Request {
+	params := &protocol.DocumentHighlightParams{}
+	params.TextDocument.URI = testURI
+	params.WorkDoneToken = token
+	params.PartialResultToken = token
+	return &Request{Method: MethodDocumentHighlight, Params: params}
+}
+
+func TestSchedulerDebounceSupersedes(t *testing.T) {
+	policies := map[string]SchedulePolicy{MethodDocumentHighlight: {Debounce: 50 * time.Millisecond}}
+	calls := make(chan *Request, 2)
+	next := func(_ context.Context, req *Request) (interface{}, error) {
+		calls <- req
+		return "ok", nil
+	}
+	h := schedulerMiddleware(newHelper(nil, zap.NewNop()), policies, zap.NewNop())(next)
+
+	older, newer := highlightRequest("1"), highlightRequest("2")
+	errs := make(chan error, 1)
+	go func() {
+		_, err := h(context.Background(), older)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	res, err := h(context.Background(), newer)
+	if err != nil || res != "ok" {
+		t.Fatalf("newer: res, err = %v, %v, want ok, nil", res, err)
+	}
+	if err := <-errs; !errors.Is(err, ErrRequestCancelled) {
+		t.Fatalf("older: err = %v, want %v", err, ErrRequestCancelled)
+	}
+	if len(calls) != 1 || <-calls != newer {
+		t.Fatal("only the newer request must be passed to the server")
+	}
+}
+
+func TestSchedulerKeyIgnoresTokens(t *testing.T) {
+	s := &scheduler{helper: newHelper(nil, zap.NewNop())}
+	k1, ok1 := s.key(highlightRequest("1"))
+	k2, ok2 := s.key(highlightRequest("2"))
+	if !ok1 || !ok2 {
+		t.Fatal("no key")
+	}
+	if k1 != k2 {
+		t.Fatalf("keys differ: %q, %q", k1, k2)
+	}
+
+	other := highlightRequest("1")
+	other.Params.(*protocol.DocumentHighlightParams).Position.Line = 1
+	if k3, _ := s.key(other); k3 == k1 {
+		t.Fatal("keys of different requests are equal")
+	}
+}
+
+func TestSchedulerCoalesceKeepsError(t *testing.T) {
+	policies := map[string]SchedulePolicy{MethodDocumentHighlight: {Coalesce: true}}
+	fail := errors.New("failed")
+	next := func(context.Context, *Request) (interface{}, error) {
+		return nil, fail
+	}
+	h := schedulerMiddleware(newHelper(nil, zap.NewNop()), policies, zap.NewNop())(next)
+
+	// The error is mapped by the outer recovery, so the scheduler must return it as it is.
+	if _, err := h(context.Background(), highlightRequest("1")); err != fail {
+		t.Fatalf("err = %v, want %v", err, fail)
+	}
+}
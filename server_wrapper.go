@@ -13,6 +13,9 @@ type serverWrapper struct {
 	helper *Helper
 	cfg    *Config
 
+	// handler is the middleware chain every request and notification is passed through.
+	handler Handler
+
 	logger *zap.Logger
 }
 
@@ -21,170 +24,208 @@ func NewServerWrapper(inner protocol.Server, helper *Helper, cfg *Config,
 	if cfg == nil {
 		cfg = &Config{}
 	}
+	mws := append([]Middleware{
+		tracingMiddleware(helper.sessionTracer(), serverSpan),
+		logTraceMiddleware(helper, lgr),
+		timeoutMiddleware(cfg.RequestTimeout, cfg.MethodTimeouts, lgr),
+		recoveryMiddleware(cfg.ErrorMapper, lgr),
+		loggingMiddleware(lgr),
+		lifecycleMiddleware(helper, cfg.Lifecycle, lgr),
+		contentModifiedMiddleware(helper, cfg.ContentModifiedMethods),
+		schedulerMiddleware(helper, cfg.Scheduling, lgr),
+	}, cfg.Middlewares...)
 	return &serverWrapper{
-		inner:  inner,
-		helper: helper,
-		cfg:    cfg,
-		logger: lgr,
+		inner:   inner,
+		helper:  helper,
+		cfg:     cfg,
+		handler: newChain(mws...),
+		logger:  lgr,
 	}
 }
 
 func (s *serverWrapper) Progress(ctx context.Context, params *protocol.ProgressParams) error {
-	s.logger.Debug("Progress", zap.Any("params", params))
-	return s.inner.Progress(ctx, params)
+	return notify(ctx, s.handler, MethodProgress, params, s.inner.Progress)
 }
 
 func (s *serverWrapper) SetTrace(ctx context.Context, params *protocol.SetTraceParams) error {
-	s.logger.Debug("SetTrace", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodSetTrace, params, s.setTrace)
+}
+
+func (s *serverWrapper) setTrace(ctx context.Context, params *protocol.SetTraceParams) error {
+	if params != nil {
+		s.helper.setTraceLevel(params.Value)
+	}
 	return s.inner.SetTrace(ctx, params)
 }
 
 func (s *serverWrapper) IncomingCalls(ctx context.Context, params *protocol.CallHierarchyIncomingCallsParams) ([]protocol.CallHierarchyIncomingCall, error) {
-	s.logger.Debug("IncomingCalls", zap.Any("params", params))
-	return s.inner.IncomingCalls(ctx, params)
+	return call(ctx, s.handler, MethodIncomingCalls, params, s.inner.IncomingCalls)
 }
 
 func (s *serverWrapper) OutgoingCalls(ctx context.Context, params *protocol.CallHierarchyOutgoingCallsParams) ([]protocol.CallHierarchyOutgoingCall, error) {
-	s.logger.Debug("OutgoingCalls", zap.Any("params", params))
-	return s.inner.OutgoingCalls(ctx, params)
+	return call(ctx, s.handler, MethodOutgoingCalls, params, s.inner.OutgoingCalls)
 }
 
 func (s *serverWrapper) ResolveCodeAction(ctx context.Context, params *protocol.CodeAction) (*protocol.CodeAction, error) {
-	s.logger.Debug("ResolveCodeAction", zap.Any("params", params))
-	return s.inner.ResolveCodeAction(ctx, params)
+	return call(ctx, s.handler, MethodResolveCodeAction, params, s.inner.ResolveCodeAction)
 }
 
 func (s *serverWrapper) ResolveCodeLens(ctx context.Context, params *protocol.CodeLens) (*protocol.CodeLens, error) {
-	s.logger.Debug("ResolveCodeLens", zap.Any("params", params))
-	return s.inner.ResolveCodeLens(ctx, params)
+	return call(ctx, s.handler, MethodResolveCodeLens, params, s.inner.ResolveCodeLens)
 }
 
 func (s *serverWrapper) ResolveCompletionItem(ctx context.Context, params *protocol.CompletionItem) (*protocol.CompletionItem, error) {
-	s.logger.Debug("ResolveCompletionItem", zap.Any("params", params))
-	return s.inner.ResolveCompletionItem(ctx, params)
+	return call(ctx, s.handler, MethodResolveCompletionItem, params, s.inner.ResolveCompletionItem)
 }
 
 func (s *serverWrapper) ResolveDocumentLink(ctx context.Context, params *protocol.DocumentLink) (*protocol.DocumentLink, error) {
-	s.logger.Debug("ResolveDocumentLink", zap.Any("params", params))
-	return s.inner.ResolveDocumentLink(ctx, params)
+	return call(ctx, s.handler, MethodResolveDocumentLink, params, s.inner.ResolveDocumentLink)
 }
 
 func (s *serverWrapper) Exit(ctx context.Context) error {
-	s.logger.Debug("Exit")
-	return s.inner.Exit(ctx)
+	return notify(ctx, s.handler, MethodExit, nil, s.exit)
+}
+
+func (s *serverWrapper) exit(ctx context.Context, _ interface{}) error {
+	if err := s.helper.transition(ctx, Exited); err != nil {
+		return err
+	}
+	err := s.inner.Exit(ctx)
+	if s.helper.cancel != nil {
+		s.helper.cancel()
+	}
+	return err
 }
 
 func (s *serverWrapper) Initialize(ctx context.Context, params *protocol.ParamInitialize) (*protocol.InitializeResult,
 	error) {
-	s.logger.Debug("Initialize", zap.Any("params", params))
-	if err := s.helper.setStatus(Initializing); err != nil {
+	return call(ctx, s.handler, MethodInitialize, params, s.initialize)
+}
+
+func (s *serverWrapper) initialize(ctx context.Context, params *protocol.ParamInitialize) (*protocol.InitializeResult,
+	error) {
+	if s.helper.GetStatus() == Created {
+		s.helper.setClientInfo(params)
+	}
+	if err := s.helper.transition(ctx, Initializing); err != nil {
 		return nil, err
 	}
 	res, err := s.inner.Initialize(ctx, params)
-	if s.helper.Cache == nil || err != nil {
+	if err != nil {
 		return res, err
 	}
-	return s.helper.Cache.initialize(params, res)
+	if s.helper.Cache != nil {
+		if res, err = s.helper.Cache.initialize(params, res); err != nil {
+			return res, err
+		}
+	}
+	return s.helper.buildCapabilities(res)
 }
 
 func (s *serverWrapper) Initialized(ctx context.Context, params *protocol.InitializedParams) error {
-	s.logger.Debug("Initialized", zap.Any("params", params))
-	if err := s.helper.setStatus(Initialized); err != nil {
+	return notify(ctx, s.handler, MethodInitialized, params, s.initialized)
+}
+
+func (s *serverWrapper) initialized(ctx context.Context, params *protocol.InitializedParams) error {
+	if err := s.helper.transition(ctx, Initialized); err != nil {
 		return err
 	}
 	return s.inner.Initialized(ctx, params)
 }
 
 func (s *serverWrapper) Resolve(ctx context.Context, params *protocol.InlayHint) (*protocol.InlayHint, error) {
-	s.logger.Debug("Resolve", zap.Any("params", params))
-	return s.inner.Resolve(ctx, params)
+	return call(ctx, s.handler, MethodResolveInlayHint, params, s.inner.Resolve)
 }
 
 func (s *serverWrapper) DidChangeNotebookDocument(ctx context.Context, params *protocol.DidChangeNotebookDocumentParams) error {
-	s.logger.Debug("DidChangeNotebookDocument", zap.Any("params", params))
-	return s.inner.DidChangeNotebookDocument(ctx, params)
+	return notify(ctx, s.handler, MethodDidChangeNotebookDocument, params, s.inner.DidChangeNotebookDocument)
 }
 
 func (s *serverWrapper) DidCloseNotebookDocument(ctx context.Context, params *protocol.DidCloseNotebookDocumentParams) error {
-	s.logger.Debug("DidCloseNotebookDocument", zap.Any("params", params))
-	return s.inner.DidCloseNotebookDocument(ctx, params)
+	return notify(ctx, s.handler, MethodDidCloseNotebookDocument, params, s.inner.DidCloseNotebookDocument)
 }
 
 func (s *serverWrapper) DidOpenNotebookDocument(ctx context.Context, params *protocol.DidOpenNotebookDocumentParams) error {
-	s.logger.Debug("DidOpenNotebookDocument", zap.Any("params", params))
-	return s.inner.DidOpenNotebookDocument(ctx, params)
+	return notify(ctx, s.handler, MethodDidOpenNotebookDocument, params, s.inner.DidOpenNotebookDocument)
 }
 
 func (s *serverWrapper) DidSaveNotebookDocument(ctx context.Context, params *protocol.DidSaveNotebookDocumentParams) error {
-	s.logger.Debug("DidSaveNotebookDocument", zap.Any("params", params))
-	return s.inner.DidSaveNotebookDocument(ctx, params)
+	return notify(ctx, s.handler, MethodDidSaveNotebookDocument, params, s.inner.DidSaveNotebookDocument)
 }
 
 func (s *serverWrapper) Shutdown(ctx context.Context) error {
-	s.logger.Debug("Shutdown")
-	if err := s.helper.setStatus(Shutdown); err != nil {
+	return callNoResult(ctx, s.handler, MethodShutdown, nil, s.shutdown)
+}
+
+func (s *serverWrapper) shutdown(ctx context.Context, _ interface{}) error {
+	if err := s.helper.transition(ctx, Shutdown); err != nil {
 		return err
 	}
 	return s.inner.Shutdown(ctx)
 }
 
 func (s *serverWrapper) CodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
-	s.logger.Debug("CodeAction", zap.Any("params", params))
-	return s.inner.CodeAction(ctx, params)
+	return call(ctx, s.handler, MethodCodeAction, params, s.inner.CodeAction)
 }
 
 func (s *serverWrapper) CodeLens(ctx context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
-	s.logger.Debug("CodeLens", zap.Any("params", params))
-	return s.inner.CodeLens(ctx, params)
+	return call(ctx, s.handler, MethodCodeLens, params, s.inner.CodeLens)
 }
 
 func (s *serverWrapper) ColorPresentation(ctx context.Context, params *protocol.ColorPresentationParams) ([]protocol.ColorPresentation, error) {
-	s.logger.Debug("ColorPresentation", zap.Any("params", params))
-	return s.inner.ColorPresentation(ctx, params)
+	return call(ctx, s.handler, MethodColorPresentation, params, s.inner.ColorPresentation)
 }
 
 func (s *serverWrapper) Completion(ctx context.Context, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
-	s.logger.Debug("Completion", zap.Any("params", params))
-	return s.inner.Completion(ctx, params)
+	return call(ctx, s.handler, MethodCompletion, params, s.inner.Completion)
 }
 
 func (s *serverWrapper) Declaration(ctx context.Context, params *protocol.DeclarationParams) (*protocol.Or_textDocument_declaration, error) {
-	s.logger.Debug("Declaration", zap.Any("params", params))
-	return s.inner.Declaration(ctx, params)
+	return call(ctx, s.handler, MethodDeclaration, params, s.inner.Declaration)
 }
 
 func (s *serverWrapper) Definition(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error) {
-	s.logger.Debug("Definition", zap.Any("params", params))
-	return s.inner.Definition(ctx, params)
+	return call(ctx, s.handler, MethodDefinition, params, s.inner.Definition)
 }
 
 func (s *serverWrapper) Diagnostic(ctx context.Context, params *string) (*string, error) {
-	s.logger.Debug("Diagnostic", zap.Any("params", params))
-	return s.inner.Diagnostic(ctx, params)
+	return call(ctx, s.handler, MethodDiagnostic, params, s.inner.Diagnostic)
 }
 
 func (s *serverWrapper) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
-	s.logger.Debug("DidChange", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidChange, params, s.didChange)
+}
+
+func (s *serverWrapper) didChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
 	if s.helper.Cache != nil {
 		if err := s.helper.Cache.didChange(params); err != nil {
 			return err
 		}
+		s.helper.cancelStaleRequests(params.TextDocument.URI)
 	}
 	return s.inner.DidChange(ctx, params)
 }
 
 func (s *serverWrapper) DidClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
-	s.logger.Debug("DidClose", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidClose, params, s.didClose)
+}
+
+func (s *serverWrapper) didClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
 	if s.helper.Cache != nil {
 		if err := s.helper.Cache.didClose(params); err != nil {
 			return err
 		}
+		s.helper.cancelStaleRequests(params.TextDocument.URI)
 	}
+	s.helper.Diagnostics.didClose(ctx, params)
 	return s.inner.DidClose(ctx, params)
 }
 
 func (s *serverWrapper) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
-	s.logger.Debug("DidOpen", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidOpen, params, s.didOpen)
+}
+
+func (s *serverWrapper) didOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
 	if s.helper.Cache != nil {
 		if err := s.helper.Cache.didOpen(params); err != nil {
 			return err
@@ -194,7 +235,10 @@ func (s *serverWrapper) DidOpen(ctx context.Context, params *protocol.DidOpenTex
 }
 
 func (s *serverWrapper) DidSave(ctx context.Context, params *protocol.DidSaveTextDocumentParams) error {
-	s.logger.Debug("DidSave", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidSave, params, s.didSave)
+}
+
+func (s *serverWrapper) didSave(ctx context.Context, params *protocol.DidSaveTextDocumentParams) error {
 	if s.helper.Cache != nil {
 		if err := s.helper.Cache.didSave(params); err != nil {
 			return err
@@ -204,221 +248,223 @@ func (s *serverWrapper) DidSave(ctx context.Context, params *protocol.DidSaveTex
 }
 
 func (s *serverWrapper) DocumentColor(ctx context.Context, params *protocol.DocumentColorParams) ([]protocol.ColorInformation, error) {
-	s.logger.Debug("DocumentColor", zap.Any("params", params))
-	return s.inner.DocumentColor(ctx, params)
+	return call(ctx, s.handler, MethodDocumentColor, params, s.inner.DocumentColor)
 }
 
 func (s *serverWrapper) DocumentHighlight(ctx context.Context, params *protocol.DocumentHighlightParams) ([]protocol.DocumentHighlight, error) {
-	s.logger.Debug("DocumentHighlight", zap.Any("params", params))
-	return s.inner.DocumentHighlight(ctx, params)
+	return call(ctx, s.handler, MethodDocumentHighlight, params, s.inner.DocumentHighlight)
 }
 
 func (s *serverWrapper) DocumentLink(ctx context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
-	s.logger.Debug("DocumentLink", zap.Any("params", params))
-	return s.inner.DocumentLink(ctx, params)
+	return call(ctx, s.handler, MethodDocumentLink, params, s.inner.DocumentLink)
 }
 
 func (s *serverWrapper) DocumentSymbol(ctx context.Context, params *protocol.DocumentSymbolParams) ([]interface{}, error) {
-	s.logger.Debug("DocumentSymbol", zap.Any("params", params))
-	return s.inner.DocumentSymbol(ctx, params)
+	return call(ctx, s.handler, MethodDocumentSymbol, params, s.inner.DocumentSymbol)
 }
 
 func (s *serverWrapper) FoldingRange(ctx context.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
-	s.logger.Debug("FoldingRange", zap.Any("params", params))
-	return s.inner.FoldingRange(ctx, params)
+	return call(ctx, s.handler, MethodFoldingRange, params, s.inner.FoldingRange)
 }
 
 func (s *serverWrapper) Formatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
-	s.logger.Debug("Formatting", zap.Any("params", params))
-	return s.inner.Formatting(ctx, params)
+	return call(ctx, s.handler, MethodFormatting, params, s.inner.Formatting)
 }
 
 func (s *serverWrapper) Hover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
-	s.logger.Debug("Hover", zap.Any("params", params))
-	return s.inner.Hover(ctx, params)
+	return call(ctx, s.handler, MethodHover, params, s.inner.Hover)
 }
 
 func (s *serverWrapper) Implementation(ctx context.Context, params *protocol.ImplementationParams) ([]protocol.Location, error) {
-	s.logger.Debug("Implementation", zap.Any("params", params))
-	return s.inner.Implementation(ctx, params)
+	return call(ctx, s.handler, MethodImplementation, params, s.inner.Implementation)
 }
 
 func (s *serverWrapper) InlayHint(ctx context.Context, params *protocol.InlayHintParams) ([]protocol.InlayHint, error) {
-	s.logger.Debug("InlayHint", zap.Any("params", params))
-	return s.inner.InlayHint(ctx, params)
+	return call(ctx, s.handler, MethodInlayHint, params, s.inner.InlayHint)
 }
 
 func (s *serverWrapper) InlineValue(ctx context.Context, params *protocol.InlineValueParams) ([]protocol.InlineValue, error) {
-	s.logger.Debug("InlineValue", zap.Any("params", params))
-	return s.inner.InlineValue(ctx, params)
+	return call(ctx, s.handler, MethodInlineValue, params, s.inner.InlineValue)
 }
 
 func (s *serverWrapper) LinkedEditingRange(ctx context.Context, params *protocol.LinkedEditingRangeParams) (*protocol.LinkedEditingRanges, error) {
-	s.logger.Debug("LinkedEditingRange", zap.Any("params", params))
-	return s.inner.LinkedEditingRange(ctx, params)
+	return call(ctx, s.handler, MethodLinkedEditingRange, params, s.inner.LinkedEditingRange)
 }
 
 func (s *serverWrapper) Moniker(ctx context.Context, params *protocol.MonikerParams) ([]protocol.Moniker, error) {
-	s.logger.Debug("Moniker", zap.Any("params", params))
-	return s.inner.Moniker(ctx, params)
+	return call(ctx, s.handler, MethodMoniker, params, s.inner.Moniker)
 }
 
 func (s *serverWrapper) OnTypeFormatting(ctx context.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
-	s.logger.Debug("OnTypeFormatting", zap.Any("params", params))
-	return s.inner.OnTypeFormatting(ctx, params)
+	return call(ctx, s.handler, MethodOnTypeFormatting, params, s.inner.OnTypeFormatting)
 }
 
 func (s *serverWrapper) PrepareCallHierarchy(ctx context.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
-	s.logger.Debug("PrepareCallHierarchy", zap.Any("params", params))
-	return s.inner.PrepareCallHierarchy(ctx, params)
+	return call(ctx, s.handler, MethodPrepareCallHierarchy, params, s.inner.PrepareCallHierarchy)
 }
 
 func (s *serverWrapper) PrepareRename(ctx context.Context, params *protocol.PrepareRenameParams) (*protocol.PrepareRename2Gn, error) {
-	s.logger.Debug("PrepareRename", zap.Any("params", params))
-	return s.inner.PrepareRename(ctx, params)
+	return call(ctx, s.handler, MethodPrepareRename, params, s.inner.PrepareRename)
 }
 
 func (s *serverWrapper) PrepareTypeHierarchy(ctx context.Context, params *protocol.TypeHierarchyPrepareParams) ([]protocol.TypeHierarchyItem, error) {
-	s.logger.Debug("PrepareTypeHierarchy", zap.Any("params", params))
-	return s.inner.PrepareTypeHierarchy(ctx, params)
+	return call(ctx, s.handler, MethodPrepareTypeHierarchy, params, s.inner.PrepareTypeHierarchy)
 }
 
 func (s *serverWrapper) RangeFormatting(ctx context.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
-	s.logger.Debug("RangeFormatting", zap.Any("params", params))
-	return s.inner.RangeFormatting(ctx, params)
+	return call(ctx, s.handler, MethodRangeFormatting, params, s.inner.RangeFormatting)
 }
 
 func (s *serverWrapper) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
-	s.logger.Debug("References", zap.Any("params", params))
-	return s.inner.References(ctx, params)
+	return call(ctx, s.handler, MethodReferences, params, s.inner.References)
 }
 
 func (s *serverWrapper) Rename(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
-	s.logger.Debug("Rename", zap.Any("params", params))
-	return s.inner.Rename(ctx, params)
+	return call(ctx, s.handler, MethodRename, params, s.inner.Rename)
 }
 
 func (s *serverWrapper) SelectionRange(ctx context.Context, params *protocol.SelectionRangeParams) ([]protocol.SelectionRange, error) {
-	s.logger.Debug("SelectionRange", zap.Any("params", params))
-	return s.inner.SelectionRange(ctx, params)
+	return call(ctx, s.handler, MethodSelectionRange, params, s.inner.SelectionRange)
 }
 
 func (s *serverWrapper) SemanticTokensFull(ctx context.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
-	s.logger.Debug("SemanticTokensFull", zap.Any("params", params))
-	return s.inner.SemanticTokensFull(ctx, params)
+	return call(ctx, s.handler, MethodSemanticTokensFull, params, s.inner.SemanticTokensFull)
 }
 
 func (s *serverWrapper) SemanticTokensFullDelta(ctx context.Context, params *protocol.SemanticTokensDeltaParams) (interface{}, error) {
-	s.logger.Debug("SemanticTokensFullDelta", zap.Any("params", params))
-	return s.inner.SemanticTokensFullDelta(ctx, params)
+	return call(ctx, s.handler, MethodSemanticTokensFullDelta, params, s.inner.SemanticTokensFullDelta)
 }
 
 func (s *serverWrapper) SemanticTokensRange(ctx context.Context, params *protocol.SemanticTokensRangeParams) (*protocol.SemanticTokens, error) {
-	s.logger.Debug("SemanticTokensRange", zap.Any("params", params))
-	return s.inner.SemanticTokensRange(ctx, params)
+	return call(ctx, s.handler, MethodSemanticTokensRange, params, s.inner.SemanticTokensRange)
 }
 
 func (s *serverWrapper) SignatureHelp(ctx context.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
-	s.logger.Debug("SignatureHelp", zap.Any("params", params))
-	return s.inner.SignatureHelp(ctx, params)
+	return call(ctx, s.handler, MethodSignatureHelp, params, s.inner.SignatureHelp)
 }
 
 func (s *serverWrapper) TypeDefinition(ctx context.Context, params *protocol.TypeDefinitionParams) ([]protocol.Location, error) {
-	s.logger.Debug("TypeDefinition", zap.Any("params", params))
-	return s.inner.TypeDefinition(ctx, params)
+	return call(ctx, s.handler, MethodTypeDefinition, params, s.inner.TypeDefinition)
 }
 
 func (s *serverWrapper) WillSave(ctx context.Context, params *protocol.WillSaveTextDocumentParams) error {
-	s.logger.Debug("WillSave", zap.Any("params", params))
-	return s.inner.WillSave(ctx, params)
+	return notify(ctx, s.handler, MethodWillSave, params, s.inner.WillSave)
 }
 
 func (s *serverWrapper) WillSaveWaitUntil(ctx context.Context, params *protocol.WillSaveTextDocumentParams) ([]protocol.TextEdit, error) {
-	s.logger.Debug("WillSaveWaitUntil", zap.Any("params", params))
-	return s.inner.WillSaveWaitUntil(ctx, params)
+	return call(ctx, s.handler, MethodWillSaveWaitUntil, params, s.inner.WillSaveWaitUntil)
 }
 
 func (s *serverWrapper) Subtypes(ctx context.Context, params *protocol.TypeHierarchySubtypesParams) ([]protocol.TypeHierarchyItem, error) {
-	s.logger.Debug("Subtypes", zap.Any("params", params))
-	return s.inner.Subtypes(ctx, params)
+	return call(ctx, s.handler, MethodSubtypes, params, s.inner.Subtypes)
 }
 
 func (s *serverWrapper) Supertypes(ctx context.Context, params *protocol.TypeHierarchySupertypesParams) ([]protocol.TypeHierarchyItem, error) {
-	s.logger.Debug("Supertypes", zap.Any("params", params))
-	return s.inner.Supertypes(ctx, params)
+	return call(ctx, s.handler, MethodSupertypes, params, s.inner.Supertypes)
 }
 
 func (s *serverWrapper) WorkDoneProgressCancel(ctx context.Context, params *protocol.WorkDoneProgressCancelParams) error {
-	s.logger.Debug("WorkDoneProgressCancel", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodWorkDoneProgressCancel, params, s.workDoneProgressCancel)
+}
+
+func (s *serverWrapper) workDoneProgressCancel(ctx context.Context, params *protocol.WorkDoneProgressCancelParams) error {
+	if params != nil {
+		s.helper.cancelProgress(params.Token)
+	}
 	return s.inner.WorkDoneProgressCancel(ctx, params)
 }
 
 func (s *serverWrapper) DiagnosticWorkspace(ctx context.Context, params *protocol.WorkspaceDiagnosticParams) (*protocol.WorkspaceDiagnosticReport, error) {
-	s.logger.Debug("DiagnosticWorkspace", zap.Any("params", params))
-	return s.inner.DiagnosticWorkspace(ctx, params)
+	return call(ctx, s.handler, MethodDiagnosticWorkspace, params, s.inner.DiagnosticWorkspace)
 }
 
 func (s *serverWrapper) DidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
-	s.logger.Debug("DidChangeConfiguration", zap.Any("params", params))
-	return s.inner.DidChangeConfiguration(ctx, params)
+	return notify(ctx, s.handler, MethodDidChangeConfiguration, params, s.didChangeConfiguration)
+}
+
+func (s *serverWrapper) didChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	// Errors are already logged, and the server still gets the notification.
+	_ = s.helper.refreshSettings(ctx, params)
+	if err := s.inner.DidChangeConfiguration(ctx, params); err != nil {
+		return err
+	}
+	_ = s.helper.RefreshRegistrations(ctx)
+	return nil
 }
 
 func (s *serverWrapper) DidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
-	s.logger.Debug("DidChangeWatchedFiles", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidChangeWatchedFiles, params, s.didChangeWatchedFiles)
+}
+
+func (s *serverWrapper) didChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	s.helper.Diagnostics.didChangeWatchedFiles(ctx, params)
 	return s.inner.DidChangeWatchedFiles(ctx, params)
 }
 
 func (s *serverWrapper) DidChangeWorkspaceFolders(ctx context.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
-	s.logger.Debug("DidChangeWorkspaceFolders", zap.Any("params", params))
-	return s.inner.DidChangeWorkspaceFolders(ctx, params)
+	return notify(ctx, s.handler, MethodDidChangeWorkspaceFolders, params, s.inner.DidChangeWorkspaceFolders)
 }
 
 func (s *serverWrapper) DidCreateFiles(ctx context.Context, params *protocol.CreateFilesParams) error {
-	s.logger.Debug("DidCreateFiles", zap.Any("params", params))
-	return s.inner.DidCreateFiles(ctx, params)
+	return notify(ctx, s.handler, MethodDidCreateFiles, params, s.inner.DidCreateFiles)
 }
 
 func (s *serverWrapper) DidDeleteFiles(ctx context.Context, params *protocol.DeleteFilesParams) error {
-	s.logger.Debug("DidDeleteFiles", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidDeleteFiles, params, s.didDeleteFiles)
+}
+
+func (s *serverWrapper) didDeleteFiles(ctx context.Context, params *protocol.DeleteFilesParams) error {
+	s.helper.Diagnostics.didDeleteFiles(ctx, params)
 	return s.inner.DidDeleteFiles(ctx, params)
 }
 
 func (s *serverWrapper) DidRenameFiles(ctx context.Context, params *protocol.RenameFilesParams) error {
-	s.logger.Debug("DidRenameFiles", zap.Any("params", params))
+	return notify(ctx, s.handler, MethodDidRenameFiles, params, s.didRenameFiles)
+}
+
+func (s *serverWrapper) didRenameFiles(ctx context.Context, params *protocol.RenameFilesParams) error {
+	s.helper.Diagnostics.didRenameFiles(ctx, params)
 	return s.inner.DidRenameFiles(ctx, params)
 }
 
 func (s *serverWrapper) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
-	s.logger.Debug("ExecuteCommand", zap.Any("params", params))
+	return call(ctx, s.handler, MethodExecuteCommand, params, s.executeCommand)
+}
+
+func (s *serverWrapper) executeCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	res, handled, err := s.helper.executeCommand(ctx, params)
+	if handled || err != nil {
+		return res, err
+	}
 	return s.inner.ExecuteCommand(ctx, params)
 }
 
 func (s *serverWrapper) Symbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
-	s.logger.Debug("Symbol", zap.Any("params", params))
-	return s.inner.Symbol(ctx, params)
+	return call(ctx, s.handler, MethodSymbol, params, s.inner.Symbol)
 }
 
 func (s *serverWrapper) WillCreateFiles(ctx context.Context, params *protocol.CreateFilesParams) (*protocol.WorkspaceEdit, error) {
-	s.logger.Debug("WillCreateFiles", zap.Any("params", params))
-	return s.inner.WillCreateFiles(ctx, params)
+	return call(ctx, s.handler, MethodWillCreateFiles, params, s.inner.WillCreateFiles)
 }
 
 func (s *serverWrapper) WillDeleteFiles(ctx context.Context, params *protocol.DeleteFilesParams) (*protocol.WorkspaceEdit, error) {
-	s.logger.Debug("WillDeleteFiles", zap.Any("params", params))
-	return s.inner.WillDeleteFiles(ctx, params)
+	return call(ctx, s.handler, MethodWillDeleteFiles, params, s.inner.WillDeleteFiles)
 }
 
 func (s *serverWrapper) WillRenameFiles(ctx context.Context, params *protocol.RenameFilesParams) (*protocol.WorkspaceEdit, error) {
-	s.logger.Debug("WillRenameFiles", zap.Any("params", params))
-	return s.inner.WillRenameFiles(ctx, params)
+	return call(ctx, s.handler, MethodWillRenameFiles, params, s.inner.WillRenameFiles)
 }
 
 func (s *serverWrapper) ResolveWorkspaceSymbol(ctx context.Context, params *protocol.WorkspaceSymbol) (*protocol.WorkspaceSymbol, error) {
-	s.logger.Debug("ResolveWorkspaceSymbol", zap.Any("params", params))
-	return s.inner.ResolveWorkspaceSymbol(ctx, params)
+	return call(ctx, s.handler, MethodResolveWorkspaceSymbol, params, s.inner.ResolveWorkspaceSymbol)
 }
 
 func (s *serverWrapper) NonstandardRequest(ctx context.Context, method string, params interface{}) (interface{}, error) {
-	s.logger.Debug("NonstandardRequest", zap.String("method", method), zap.Any("params", params))
-	return s.inner.NonstandardRequest(ctx, method, params)
+	return call(ctx, s.handler, method, params, func(ctx context.Context, params interface{}) (interface{}, error) {
+		res, handled, err := s.helper.handleCustom(ctx, method, params)
+		if handled {
+			return res, err
+		}
+		return s.inner.NonstandardRequest(ctx, method, params)
+	})
 }
@@ -0,0 +1,257 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+// SettingsOptions configures a settings section added by `AddSettings`.
+type SettingsOptions[T any] struct {
+	// Default is the value used until the settings are received, and the base the received settings are decoded
+	// onto, so the fields missing from them keep their default values.
+	Default T
+	// Validate checks the decoded value. Optional: if it returns an error, the value is ignored and the previous one
+	// is kept.
+	Validate func(T) error
+	// OnChange is called when the value for `scope` changes. `scope` is empty for the global value. Optional.
+	OnChange func(ctx context.Context, scope protocol.DocumentURI, old, new T)
+}
+
+// Settings is a typed settings section of the workspace configuration, added by `AddSettings`.
+type Settings[T any] struct {
+	helper  *Helper
+	section string
+	opts    SettingsOptions[T]
+	// defaults is `opts.Default` encoded in JSON, decoded into a fresh value for every update, so that the decoded
+	// settings share no maps, slices or pointers with the default value, or with each other.
+	defaults []byte
+
+	mu     sync.RWMutex
+	value  T
+	scoped map[protocol.DocumentURI]T
+}
+
+// settingsSection is the type independent part of `Settings`, used by `Helper`.
+type settingsSection interface {
+	name() string
+	// scopes returns the scopes to pull, including the empty (global) one.
+	scopes() []protocol.DocumentURI
+	update(ctx context.Context, scope protocol.DocumentURI, raw interface{}, notify bool)
+}
+
+// AddSettings adds the settings `section` (like "myServer" or "myServer.formatting") of the workspace configuration
+// to `h`, decoded into `T` from JSON. It must be called before `initialize` request.
+//
+// If the client supports `workspace/configuration` request, the settings are pulled after `initialized` notification,
+// and on every `workspace/didChangeConfiguration` notification. Otherwise, the settings sent in
+// `workspace/didChangeConfiguration` notification are used. The settings are updated before the notification is
+// passed to the server.
+func AddSettings[T any](h *Helper, section string, opts SettingsOptions[T]) *Settings[T] {
+	s := &Settings[T]{
+		helper:  h,
+		section: section,
+		opts:    opts,
+		scoped:  make(map[protocol.DocumentURI]T),
+	}
+	var err error
+	if s.defaults, err = json.Marshal(opts.Default); err != nil {
+		h.logger.Warn("invalid default settings", zap.String("section", section), zap.Error(err))
+	}
+	s.value = s.newDefault()
+
+	h.settingsMu.Lock()
+	first := len(h.settings) == 0
+	h.settings = append(h.settings, s)
+	h.settingsMu.Unlock()
+
+	if first {
+		// Some clients send `workspace/didChangeConfiguration` only if it is registered. The registration is sent
+		// after `initialized` notification, so the context isn't used here.
+		_, _ = h.Register(context.Background(), DynamicCapability{Method: MethodDidChangeConfiguration})
+	}
+
+	return s
+}
+
+// Section returns the name of the settings section.
+func (s *Settings[T]) Section() string {
+	return s.section
+}
+
+// Get returns the current global value of the settings.
+func (s *Settings[T]) Get() T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+// Scoped returns the value of the settings for the scope `uri` (e.g. a workspace folder or a document). The value is
+// pulled from the client on the first call for `uri`, and refreshed with the global value afterwards. The global
+// value is returned if the client doesn't support `workspace/configuration` request.
+func (s *Settings[T]) Scoped(ctx context.Context, uri protocol.DocumentURI) (T, error) {
+	if v, ok := s.scopedValue(uri); ok {
+		return v, nil
+	}
+
+	h := s.helper
+	if h.GetStatus() != Initialized || !h.SupportsConfiguration() {
+		return s.Get(), nil
+	}
+
+	res, err := h.clnt.Configuration(ctx, &protocol.ParamConfiguration{
+		Items: []protocol.ConfigurationItem{{ScopeURI: string(uri), Section: s.section}},
+	})
+	if err != nil {
+		return s.Get(), err
+	}
+	var raw interface{}
+	if len(res) > 0 {
+		raw = res[0]
+	}
+	s.update(ctx, uri, raw, false)
+
+	if v, ok := s.scopedValue(uri); ok {
+		return v, nil
+	}
+	return s.Get(), nil
+}
+
+func (s *Settings[T]) scopedValue(uri protocol.DocumentURI) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.scoped[uri]
+	return v, ok
+}
+
+func (s *Settings[T]) name() string {
+	return s.section
+}
+
+func (s *Settings[T]) scopes() []protocol.DocumentURI {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scopes := make([]protocol.DocumentURI, 0, len(s.scoped)+1)
+	scopes = append(scopes, "")
+	for uri := range s.scoped {
+		scopes = append(scopes, uri)
+	}
+	return scopes
+}
+
+// newDefault returns a deep copy of the default value.
+func (s *Settings[T]) newDefault() T {
+	var v T
+	if s.defaults == nil || json.Unmarshal(s.defaults, &v) != nil {
+		return s.opts.Default
+	}
+	return v
+}
+
+// update decodes `raw` settings for `scope`, and calls `OnChange` if the value has changed and `notify` is set.
+func (s *Settings[T]) update(ctx context.Context, scope protocol.DocumentURI, raw interface{}, notify bool) {
+	lgr := s.helper.logger.With(zap.String("section", s.section), zap.String("scope", string(scope)))
+
+	v := s.newDefault()
+	if raw != nil {
+		data, err := json.Marshal(raw)
+		if err == nil {
+			err = json.Unmarshal(data, &v)
+		}
+		if err != nil {
+			lgr.Warn("invalid settings", zap.Error(err))
+			return
+		}
+	}
+	if s.opts.Validate != nil {
+		if err := s.opts.Validate(v); err != nil {
+			lgr.Warn("invalid settings", zap.Error(err))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	var old T
+	if scope == "" {
+		old = s.value
+		s.value = v
+	} else {
+		old = s.scoped[scope]
+		s.scoped[scope] = v
+	}
+	s.mu.Unlock()
+
+	if notify && s.opts.OnChange != nil && !reflect.DeepEqual(old, v) {
+		s.opts.OnChange(ctx, scope, old, v)
+	}
+}
+
+// refreshSettings updates all the settings sections, by pulling them from the client if supported, or from `params`
+// otherwise.
+func (h *Helper) refreshSettings(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	h.settingsMu.Lock()
+	sections := h.settings
+	h.settingsMu.Unlock()
+
+	if len(sections) == 0 {
+		return nil
+	}
+
+	if !h.SupportsConfiguration() {
+		if params == nil {
+			return nil
+		}
+		for _, s := range sections {
+			s.update(ctx, "", lookupSection(params.Settings, s.name()), true)
+		}
+		return nil
+	}
+
+	type target struct {
+		section settingsSection
+		scope   protocol.DocumentURI
+	}
+	var (
+		targets []target
+		cp      protocol.ParamConfiguration
+	)
+	for _, s := range sections {
+		for _, scope := range s.scopes() {
+			targets = append(targets, target{section: s, scope: scope})
+			cp.Items = append(cp.Items, protocol.ConfigurationItem{ScopeURI: string(scope), Section: s.name()})
+		}
+	}
+
+	res, err := h.clnt.Configuration(ctx, &cp)
+	if err != nil {
+		h.logger.Error("Configuration", zap.Error(err))
+		return err
+	}
+	for i, raw := range res {
+		if i < len(targets) {
+			targets[i].section.update(ctx, targets[i].scope, raw, true)
+		}
+	}
+	return nil
+}
+
+// lookupSection returns the value of the dot separated `section` in `settings`, or `nil` if not found.
+func lookupSection(settings interface{}, section string) interface{} {
+	if section == "" {
+		return settings
+	}
+	for _, key := range strings.Split(section, ".") {
+		m, ok := settings.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		settings = m[key]
+	}
+	return settings
+}
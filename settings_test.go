@@ -0,0 +1,64 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/peske/lsp-srv/lsp/protocol"
+	"go.uber.org/zap"
+)
+
+func TestSettingsUpdate(t *testing.T) {
+	type settings struct {
+		Flags map[string]bool `json:"flags"`
+	}
+	h := newHelper(nil, zap.NewNop())
+	changes := 0
+	s := AddSettings(h, "test", SettingsOptions[settings]{
+		Default: settings{Flags: map[string]bool{"a": true}},
+		OnChange: func(context.Context, protocol.DocumentURI, settings, settings) {
+			changes++
+		},
+	})
+
+	tests := []struct {
+		name        string
+		raw         interface{}
+		want        map[string]bool
+		wantChanges int
+	}{
+		{
+			name:        "key added",
+			raw:         map[string]interface{}{"flags": map[string]interface{}{"b": true}},
+			want:        map[string]bool{"a": true, "b": true},
+			wantChanges: 1,
+		},
+		{
+			name:        "key removed",
+			raw:         map[string]interface{}{"flags": map[string]interface{}{}},
+			want:        map[string]bool{"a": true},
+			wantChanges: 2,
+		},
+		{
+			name:        "unchanged",
+			raw:         map[string]interface{}{},
+			want:        map[string]bool{"a": true},
+			wantChanges: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.update(context.Background(), "", tt.raw, true)
+			if got := s.Get().Flags; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("flags = %v, want %v", got, tt.want)
+			}
+			if changes != tt.wantChanges {
+				t.Fatalf("OnChange called %d times, want %d", changes, tt.wantChanges)
+			}
+			if want := map[string]bool{"a": true}; !reflect.DeepEqual(s.opts.Default.Flags, want) {
+				t.Fatalf("default flags = %v, want %v", s.opts.Default.Flags, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// timeoutMiddleware fails the requests not handled within the timeout with `ErrRequestCancelled`, and cancels their
+// context. `timeout` doesn't apply to `initialize` and `shutdown`. The handler keeps running in the background until
+// it returns, but its result is discarded.
+func timeoutMiddleware(timeout time.Duration, methodTimeouts map[string]time.Duration, lgr *zap.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			t, ok := methodTimeouts[req.Method]
+			if !ok && req.Method != MethodInitialize && req.Method != MethodShutdown {
+				// The lifecycle requests must complete, unless their timeouts are set explicitly.
+				t = timeout
+			}
+			if req.Notification || t <= 0 {
+				return next(ctx, req)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, t)
+			defer cancel()
+
+			type result struct {
+				res interface{}
+				err error
+			}
+			done := make(chan result, 1)
+			go func() {
+				res, err := next(ctx, req)
+				done <- result{res: res, err: err}
+			}()
+
+			select {
+			case r := <-done:
+				return r.res, r.err
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					lgr.Warn("request timeout", zap.String("method", req.Method), zap.Duration("timeout", t))
+					return nil, fmt.Errorf("%w: %s: timeout after %s", ErrRequestCancelled, req.Method, t)
+				}
+				return nil, fmt.Errorf("%w: %s: %v", ErrRequestCancelled, req.Method, ctx.Err())
+			}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Kinds of the spans, as defined by OpenTelemetry.
+const (
+	serverSpan = 2 // an incoming request or notification
+	clientSpan = 3 // an outgoing request or notification
+)
+
+// traceSpan is the trace of a single request or notification.
+type traceSpan struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	kind       int
+	method     string
+	start      time.Time
+	duration   time.Duration
+	paramsSize int
+	resultSize int
+	err        error
+}
+
+type spanContextKey struct{}
+
+// tracer records the spans of the requests and notifications, which are logged, and exported to a file in
+// OpenTelemetry (OTLP) JSON format.
+type tracer struct {
+	log    bool
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// newTracer creates the tracer configured by `cfg`, or returns `nil` if tracing isn't enabled.
+func newTracer(cfg *Config, lgr *zap.Logger) (*tracer, error) {
+	if cfg == nil || (!cfg.Tracing && cfg.TraceFile == "") {
+		return nil, nil
+	}
+	t := &tracer{
+		log:    cfg.Tracing,
+		logger: lgr.With(zap.String("object", "tracer")),
+	}
+	if cfg.TraceFile != "" {
+		f, err := os.OpenFile(cfg.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		t.file = f
+		t.enc = json.NewEncoder(f)
+	}
+	return t, nil
+}
+
+func (t *tracer) close() {
+	if t == nil || t.file == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.file.Close(); err != nil {
+		t.logger.Warn("close", zap.Error(err))
+	}
+	t.file, t.enc = nil, nil
+}
+
+// sessionTracer returns the tracer of the session, or `nil` if tracing isn't enabled.
+func (h *Helper) sessionTracer() *tracer {
+	if h == nil {
+		return nil
+	}
+	return h.tracer
+}
+
+// tracingMiddleware records a span of `kind` for every request and notification. The span of an outgoing call is a
+// child of the span of the incoming request in its context, if any. Returns `nil` if `t` is `nil`.
+func tracingMiddleware(t *tracer, kind int) Middleware {
+	if t == nil {
+		return nil
+	}
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (interface{}, error) {
+			s := &traceSpan{
+				spanID: newTraceID(8),
+				kind:   kind,
+				method: req.Method,
+				start:  time.Now(),
+			}
+			if parent, ok := ctx.Value(spanContextKey{}).(*traceSpan); ok {
+				s.traceID, s.parentID = parent.traceID, parent.spanID
+			} else {
+				s.traceID = newTraceID(16)
+			}
+			ctx = context.WithValue(ctx, spanContextKey{}, s)
+
+			s.paramsSize = payloadSize(req.Params)
+			res, err := next(ctx, req)
+			s.duration = time.Since(s.start)
+			s.resultSize = payloadSize(res)
+			s.err = err
+
+			t.record(s)
+			return res, err
+		}
+	}
+}
+
+func (t *tracer) record(s *traceSpan) {
+	if t.log {
+		outcome := "ok"
+		if s.err != nil {
+			outcome = "error"
+		}
+		t.logger.Info(s.method,
+			zap.String("kind", spanKindName(s.kind)),
+			zap.String("traceId", s.traceID),
+			zap.String("spanId", s.spanID),
+			zap.String("parentSpanId", s.parentID),
+			zap.Duration("duration", s.duration),
+			zap.String("outcome", outcome),
+			zap.Int("paramsSize", s.paramsSize),
+			zap.Int("resultSize", s.resultSize),
+			zap.Error(s.err))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.enc == nil {
+		return
+	}
+	if err := t.enc.Encode(s.otlp()); err != nil {
+		t.logger.Warn("export", zap.Error(err))
+	}
+}
+
+// otlp returns the span in OTLP JSON format, as a complete export request, so that every line of the file can be
+// imported on its own.
+func (s *traceSpan) otlp() interface{} {
+	type (
+		value struct {
+			StringValue *string `json:"stringValue,omitempty"`
+			IntValue    *string `json:"intValue,omitempty"`
+		}
+		attribute struct {
+			Key   string `json:"key"`
+			Value value  `json:"value"`
+		}
+	)
+	str := func(key, v string) attribute { return attribute{Key: key, Value: value{StringValue: &v}} }
+	num := func(key string, v int) attribute {
+		n := strconv.Itoa(v)
+		return attribute{Key: key, Value: value{IntValue: &n}}
+	}
+
+	status := map[string]interface{}{"code": 1}
+	if s.err != nil {
+		status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+	}
+	attributes := []attribute{
+		str("rpc.system", "jsonrpc"),
+		str("rpc.method", s.method),
+		num("lsp.params.size", s.paramsSize),
+		num("lsp.result.size", s.resultSize),
+	}
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.method,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.start.Add(s.duration).UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []attribute{str("service.name", "lsp-srv-ex")},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/peske/lsp-srv-ex"},
+				"spans": []interface{}{span},
+			}},
+		}},
+	}
+}
+
+func spanKindName(kind int) string {
+	if kind == clientSpan {
+		return "client"
+	}
+	return "server"
+}
+
+// newTraceID returns a random ID of `n` bytes, hex encoded.
+func newTraceID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// payloadSize returns the size of `v` encoded in JSON, or 0 if `v` is `nil`.
+func payloadSize(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
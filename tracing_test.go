@@ -0,0 +1,33 @@
+package lsp_srv_ex
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTracingMiddlewareParent(t *testing.T) {
+	tr := &tracer{}
+	var server, client *traceSpan
+	call := func(ctx context.Context, _ *Request) (interface{}, error) {
+		client, _ = ctx.Value(spanContextKey{}).(*traceSpan)
+		return nil, nil
+	}
+	handle := func(ctx context.Context, _ *Request) (interface{}, error) {
+		server, _ = ctx.Value(spanContextKey{}).(*traceSpan)
+		// The calls to the client made with the context of the incoming request are children of its span.
+		return tracingMiddleware(tr, clientSpan)(call)(ctx, &Request{Method: MethodConfiguration})
+	}
+
+	if _, err := tracingMiddleware(tr, serverSpan)(handle)(context.Background(), &Request{Method: MethodHover}); err != nil {
+		t.Fatal(err)
+	}
+	if server == nil || client == nil {
+		t.Fatal("no spans")
+	}
+	if server.parentID != "" {
+		t.Fatalf("server span parent = %q, want none", server.parentID)
+	}
+	if client.traceID != server.traceID || client.parentID != server.spanID {
+		t.Fatalf("client span = %+v, want a child of %+v", client, server)
+	}
+}